@@ -13,24 +13,52 @@ package main
 
 import (
 	"fmt"
+	"bufio"
+	"io"
 	"os"
 	"time"
 	"net"
 	"net/url"
+	"net/http"
+	"log"
 	"math"
 	"crypto/rand"
 	mrand "math/rand"
 	"encoding/pem"
 	"errors"
+	"html"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"crypto/aes"
+	"crypto/des"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha512"
+	"crypto"
+	"encoding/asn1"
+	"hash"
+	"crypto/sha256"
+	"encoding/hex"
+	"compress/gzip"
 	"encoding/json"
+	"encoding/xml"
+	"mime"
 	"strings"
 	"strconv"
 	"bytes"
 	"github.com/andrewhodel/go-ip-ac"
+	"github.com/yuin/goldmark"
+	"github.com/andybalholm/brotli"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
 	"path/filepath"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"os/signal"
 )
@@ -39,6 +67,22 @@ type Config struct {
 	SslKey				string	`json:"sslKey"`
 	SslCert				string	`json:"sslCert"`
 	SslCa				string	`json:"sslCa"`
+	SslPassphrase			string	`json:"sslPassphrase"`
+	// the passphrase of an encrypted key is read from this file or environment variable instead of sslPassphrase
+	SslPassphraseFile		string	`json:"sslPassphraseFile"`
+	SslPassphraseEnv		string	`json:"sslPassphraseEnv"`
+	CertExpiryWarningDays		int	`json:"certExpiryWarningDays"`
+	Acme				AcmeConfig	`json:"acme"`
+	// each site has hostnames, a certificate, posts and template directories, the settings above are used when there are no sites
+	Sites				[]*Site	`json:"sites"`
+	// the hostname of the site that is served for unknown hostnames, unknown hostnames are rejected when it is empty
+	DefaultSite			string	`json:"defaultSite"`
+	// hostnames that are redirected to fqdn when there are no sites, www.domain.com
+	Aliases				[]string	`json:"aliases"`
+	// redirect unknown hostnames to the first hostname of the default site instead of serving the default site
+	RedirectUnknownHostnames	bool	`json:"redirectUnknownHostnames"`
+	// redirect /path/ to /path when /path is a page or file
+	RemoveTrailingSlash		bool	`json:"removeTrailingSlash"`
 	LoadCertificatesFromFiles	bool	`json:"loadCertificatesFromFiles"`
 	Fqdn				string	`json:"fqdn"`
 	Port				int64	`json:"port"`
@@ -47,32 +91,309 @@ type Config struct {
 	IpacBlockAfterNewConnections	int	`json:"ipacBlockAfterNewConnections"`
 	RecentPostsCount		int	`json:"recentPostsCount"`
 	RecentPostsTitlesCount		int	`json:"recentPostsTitlesCount"`
+	Title				string	`json:"title"`
+	Description			string	`json:"description"`
+	FeedPostsCount			int	`json:"feedPostsCount"`
+	RobotsDisallow			[]string	`json:"robotsDisallow"`
+	ContentPollSeconds		int	`json:"contentPollSeconds"`
+	GonePosts			[]string	`json:"gonePosts"`
+	IdleTimeoutSeconds		int	`json:"idleTimeoutSeconds"`
+	MaxRequestsPerConnection	int	`json:"maxRequestsPerConnection"`
+	// extension to Content-Type, {"glb": "model/gltf-binary"}
+	MimeTypes			map[string] string	`json:"mimeTypes"`
+	SecurityHeaders			SecurityHeadersConfig	`json:"securityHeaders"`
+}
+
+// a blog served for its hostnames, settings that are not set are the top level settings in config.json
+type Site struct {
+	// the first hostname is the canonical hostname of the site
+	Hostnames			[]string	`json:"hostnames"`
+	// hostnames that are redirected to the first hostname
+	Aliases				[]string	`json:"aliases"`
+	SslKey				string	`json:"sslKey"`
+	SslCert				string	`json:"sslCert"`
+	SslCa				string	`json:"sslCa"`
+	SslPassphrase			string	`json:"sslPassphrase"`
+	SslPassphraseFile		string	`json:"sslPassphraseFile"`
+	SslPassphraseEnv		string	`json:"sslPassphraseEnv"`
+	// posts/ and main/ by default
+	PostsDirectory			string	`json:"postsDirectory"`
+	TemplateDirectory		string	`json:"templateDirectory"`
+	RecentPostsCount		int	`json:"recentPostsCount"`
+	RecentPostsTitlesCount		int	`json:"recentPostsTitlesCount"`
+	Title				string	`json:"title"`
+	Description			string	`json:"description"`
+	FeedPostsCount			int	`json:"feedPostsCount"`
+	RobotsDisallow			[]string	`json:"robotsDisallow"`
+	GonePosts			[]string	`json:"gonePosts"`
+
+	// the content served by handle_http_request
+	Snapshot			atomic.Pointer[SiteSnapshot]	`json:"-"`
+	// the certificate that is sent in each TLS handshake for the hostnames
+	Certificate			atomic.Pointer[tls.Certificate]	`json:"-"`
+	// content_loop builds the content again when there are inotify events in the posts and template directories
+	ContentChanged			chan bool	`json:"-"`
+}
+
+type AcmeConfig struct {
+	// certificates for the hostnames of each site and names are obtained and renewed with ACME instead of the sslCert and sslKey files
+	Enabled				bool	`json:"enabled"`
+	Email				string	`json:"email"`
+	Names				[]string	`json:"names"`
+	// Let's Encrypt when empty, https://localhost:14000/dir for a Pebble test server
+	DirectoryUrl			string	`json:"directoryUrl"`
+	// the CA of the directory url when it is not trusted by the system, pebble.minica.pem
+	DirectoryCaFile			string	`json:"directoryCaFile"`
+	// the account key and certificates are stored in this directory
+	CacheDirectory			string	`json:"cacheDirectory"`
+}
+
+type SecurityHeadersConfig struct {
+	// header name to value, replaces the default_security_headers and an empty value removes a header
+	Headers				map[string] string	`json:"headers"`
+	// url path prefix of a directory in main/ to headers that replace Headers for the directory, {"/media/": {...}}
+	Paths				map[string] map[string] string	`json:"paths"`
 }
 
 var connection_count = 0
 var connection_counts []int
-var updating_content = false
-var categories map[string] []string
-var new_categories map[string] []string
-var posts_by_date map[string] time.Time
-var new_posts_by_date map[string] time.Time
-var titles map[string] string
-var new_titles map[string] string
-var short_posts map[string] string
-var content map[string] string
-var new_content map[string] string
-var sending_content = 0
 var ip_ac ipac.Ipac
 var config Config
 var mime_types map[string] string
 
-func parse_post(post_path string, p string) {
+// the content served by handle_http_request
+// a SiteSnapshot is not modified after it is stored in Site.Snapshot
+type SiteSnapshot struct {
+	// the site the snapshot is built for
+	Site				*Site
+	Content				map[string] string
+	Categories			map[string] []string
+	PostsByDate			map[string] time.Time
+	Titles				map[string] string
+	ShortPosts			map[string] string
+	PostDescriptions		map[string] string
+	PostMtimes			map[string] time.Time
+	NextPublishChange		time.Time
+	// post urls that return 410 Gone
+	Gone				map[string] bool
+	// rendered pages by url
+	Pages				map[string] *Page
+}
+
+type Page struct {
+	Body				[]byte
+	ContentType			string
+	GzipBody			[]byte
+	BrotliBody			[]byte
+	ETag				string
+	// the time the page was changed
+	LastModified			time.Time
+}
+
+// the site served for unknown hostnames or nil
+var default_site *Site
+
+func init_sites() {
+	// create the sites from config.json, the top level settings are a site when there are no sites
+
+	if (len(config.Sites) == 0) {
+		// one site for the fqdn that is served for every hostname
+		config.Sites = []*Site{&Site{Hostnames: []string{config.Fqdn}, Aliases: config.Aliases}}
+		if (config.DefaultSite == "") {
+			config.DefaultSite = config.Fqdn
+		}
+	}
+
+	for i := range config.Sites {
+
+		var s = config.Sites[i]
+
+		if (len(s.Hostnames) == 0) {
+			fmt.Println("each entry in sites must have hostnames")
+			os.Exit(1)
+		}
+
+		for h := range s.Hostnames {
+			s.Hostnames[h] = strings.TrimSuffix(strings.ToLower(s.Hostnames[h]), ".")
+		}
+		for a := range s.Aliases {
+			s.Aliases[a] = strings.TrimSuffix(strings.ToLower(s.Aliases[a]), ".")
+		}
+
+		if (s.PostsDirectory == "") {
+			s.PostsDirectory = "posts"
+		}
+		if (s.TemplateDirectory == "") {
+			s.TemplateDirectory = "main"
+		}
+		s.PostsDirectory = strings.TrimSuffix(s.PostsDirectory, "/")
+		s.TemplateDirectory = strings.TrimSuffix(s.TemplateDirectory, "/")
+
+		// the settings that are not set are the top level settings
+		if (s.SslKey == "" && s.SslCert == "") {
+			s.SslKey = config.SslKey
+			s.SslCert = config.SslCert
+			if (s.SslCa == "") {
+				s.SslCa = config.SslCa
+			}
+		}
+		if (s.SslPassphrase == "" && s.SslPassphraseFile == "" && s.SslPassphraseEnv == "") {
+			s.SslPassphrase = config.SslPassphrase
+			s.SslPassphraseFile = config.SslPassphraseFile
+			s.SslPassphraseEnv = config.SslPassphraseEnv
+		}
+		if (s.RecentPostsCount <= 0) {
+			s.RecentPostsCount = config.RecentPostsCount
+		}
+		if (s.RecentPostsTitlesCount <= 0) {
+			s.RecentPostsTitlesCount = config.RecentPostsTitlesCount
+		}
+		if (s.FeedPostsCount <= 0) {
+			s.FeedPostsCount = config.FeedPostsCount
+		}
+		if (s.Title == "") {
+			s.Title = config.Title
+		}
+		if (s.Description == "") {
+			s.Description = config.Description
+		}
+		if (s.RobotsDisallow == nil) {
+			s.RobotsDisallow = config.RobotsDisallow
+		}
+		if (s.GonePosts == nil) {
+			s.GonePosts = config.GonePosts
+		}
+
+		s.ContentChanged = make(chan bool, 1)
+
+		// an empty snapshot is served until content_loop builds the first snapshot
+		s.Snapshot.Store(new_site_snapshot(s))
+
+	}
+
+	if (config.DefaultSite != "") {
+		default_site = nil
+		var h = strings.TrimSuffix(strings.ToLower(config.DefaultSite), ".")
+		for i := range config.Sites {
+			for n := range config.Sites[i].Hostnames {
+				if (config.Sites[i].Hostnames[n] == h) {
+					default_site = config.Sites[i]
+				}
+			}
+		}
+		if (default_site == nil) {
+			fmt.Println("defaultSite is not a hostname of a site:", config.DefaultSite)
+			os.Exit(1)
+		}
+	}
+
+}
+
+func normalize_host(host string) (string) {
+	// remove the port and the trailing dot of a Host header and use lower case
+
+	h, _, err := net.SplitHostPort(host)
+	if (err == nil) {
+		host = h
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+
+}
+
+func site_for_host(host string) (*Site) {
+	// return the site of a hostname from SNI or the Host header, the default site or nil
+
+	host = normalize_host(host)
+
+	for i := range config.Sites {
+		for n := range config.Sites[i].Hostnames {
+			if (config.Sites[i].Hostnames[n] == host) {
+				return config.Sites[i]
+			}
+		}
+		for a := range config.Sites[i].Aliases {
+			if (config.Sites[i].Aliases[a] == host) {
+				return config.Sites[i]
+			}
+		}
+	}
+
+	return default_site
+
+}
+
+func redirect_to_canonical_host(s *Site, host string) (bool) {
+	// return true when a request for the hostname must be redirected to the first hostname of the site
+	// an alias is redirected and an unknown hostname is redirected with redirectUnknownHostnames
+
+	host = normalize_host(host)
+
+	if (host == "") {
+		// HTTP/1.0 requests without a Host header are served
+		return false
+	}
+
+	for a := range s.Aliases {
+		if (s.Aliases[a] == host) {
+			return true
+		}
+	}
+
+	if (config.RedirectUnknownHostnames == true) {
+		for n := range s.Hostnames {
+			if (s.Hostnames[n] == host) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+
+}
+
+func new_site_snapshot(s *Site) (*SiteSnapshot) {
+
+	var ns SiteSnapshot
+	ns.Site = s
+	ns.Content = make(map[string] string)
+	ns.Categories = make(map[string] []string)
+	ns.PostsByDate = make(map[string] time.Time)
+	ns.Titles = make(map[string] string)
+	ns.ShortPosts = make(map[string] string)
+	ns.PostDescriptions = make(map[string] string)
+	ns.PostMtimes = make(map[string] time.Time)
+	ns.Gone = make(map[string] bool)
+	ns.Pages = make(map[string] *Page)
+
+	return &ns
+
+}
+
+// CommonMark with GFM tables, strikethrough, autolinks and task lists
+// raw html is allowed in markdown posts as it is in html posts
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM), goldmark.WithRendererOptions(gmhtml.WithUnsafe()))
+
+func parse_post(ns *SiteSnapshot, post_path string, p string) {
 	// do not use as a go subroutine
 
 	// displayed on recent posts
 	var short_html = ""
+	// the short html block without the recent posts wrapper, used as the feed description
+	var short_block = ""
 	// displayed when post is viewed
 	var full_html = "<div class=\"post\">"
+	// the long html block
+	var long_block = ""
+
+	// .md.blog files and files with the format: markdown header are markdown
+	var is_markdown = strings.HasSuffix(post_path, ".md.blog")
+
+	// drafts, posts with a date in the future and expired posts are not published
+	var is_draft = false
+	var post_date time.Time
+	var expires time.Time
 
 	var title_string = ""
 	var ts_string = ""
@@ -95,19 +416,45 @@ func parse_post(post_path string, p string) {
 			// headers
 			//fmt.Println("headers line", line)
 
-			if (strings.Index(line, "date: ") == 0) {
+			if (strings.Index(line, "status: ") == 0) {
+
+				// status: draft keeps the post out of every index and url
+				is_draft = strings.TrimSpace(strings.TrimPrefix(line, "status: ")) == "draft"
+
+			} else if (strings.Index(line, "expires: ") == 0) {
+
+				// unix timestamp, seconds since 1970, when the post is removed
+				exp, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "expires: ")), 10, 64)
+				if (err == nil) {
+					expires = time.Unix(exp, 0)
+				} else {
+					fmt.Println("error parsing expires for file:", post_path, err)
+				}
+
+			} else if (strings.Index(line, "format: ") == 0) {
+
+				// the format of the short and long blocks, html or markdown
+				is_markdown = strings.TrimSpace(strings.TrimPrefix(line, "format: ")) == "markdown"
+
+			} else if (strings.Index(line, "date: ") == 0) {
 
 				// parse date
 				// unix timestamp, seconds since 1970
 				date, err := strconv.ParseInt(strings.TrimPrefix(line, "date: "), 10, 64)
 				if (err == nil) {
 					var ts = time.Unix(date, 0)
-					new_posts_by_date[post_path] = time.Unix(date, 0)
+					post_date = ts
+					ns.PostsByDate[post_path] = time.Unix(date, 0)
 					ts_string = "<span class=\"unix_ts post_date\">" + strconv.FormatInt(ts.Unix(), 10) + "</span>"
 				} else {
 					fmt.Println("error parsing date for file:", post_path, err)
 				}
 
+			} else if (strings.Index(line, "description: ") == 0) {
+
+				// the meta description of the post
+				ns.Content["description:/" + post_path] = strings.TrimSpace(strings.TrimPrefix(line, "description: "))
+
 			} else if (strings.Index(line, "categories: ") == 0) {
 
 				var cats_str = strings.TrimPrefix(line, "categories: ")
@@ -117,11 +464,11 @@ func parse_post(post_path string, p string) {
 
 					var cat = cats[c]
 
-					// add to new_categories
-					new_categories[cat] = append(new_categories[cat], post_path)
+					// add to categories
+					ns.Categories[cat] = append(ns.Categories[cat], post_path)
 
 					// add to categories_string as html element to be displayed when the full post is viewed
-					categories_string += "<a href=\"/categories/" + cat + "\">" + cat + "</a>"
+					categories_string += "<a href=\"" + html.EscapeString(category_path(cat)) + "\">" + html.EscapeString(cat) + "</a>"
 
 				}
 
@@ -130,15 +477,15 @@ func parse_post(post_path string, p string) {
 				// get the title from the header line
 				var title = strings.TrimPrefix(line, "title: ")
 
-				// add the title to new_titles
-				new_titles[post_path] = title
+				// add the title to titles
+				ns.Titles[post_path] = title
 
 				// store the title string
-				title_string = "<span class=\"post_title\">" + title + "</span>"
+				title_string = "<span class=\"post_title\">" + html.EscapeString(title) + "</span>"
 
 				// create the start of short_html
 				// with the unique strings that represent the positions of these blocks
-				short_html += "<div class=\"recent_posts_entry\"><a class=\"recent_post_title\" href=\"" + post_path + "\">" + title + "</a><span class=\"unix_ts recent_post_date\"><!--######rp_ts######--></span><div class=\"recent_post_categories\"><!--######rp_cats######--></div><div class=\"recent_post_content\">" + "\n"
+				short_html += "<div class=\"recent_posts_entry\"><a class=\"recent_post_title\" href=\"" + html.EscapeString(escape_path("/" + post_path)) + "\">" + html.EscapeString(title) + "</a><span class=\"unix_ts recent_post_date\"><!--######rp_ts######--></span><div class=\"recent_post_categories\"><!--######rp_cats######--></div><div class=\"recent_post_content\">" + "\n"
 
 			}
 
@@ -146,7 +493,7 @@ func parse_post(post_path string, p string) {
 			// short html
 
 			//fmt.Println("short html line", line)
-			short_html += line + "\n"
+			short_block += line + "\n"
 
 		} else if (block_counter == 2) {
 			// full html
@@ -154,25 +501,13 @@ func parse_post(post_path string, p string) {
 
 			if (full_html_started == false) {
 
-				// finish tags in short_html
-				short_html += "</div></div>" + "\n"
+				// add the short block and finish tags in short_html
+				short_block = render_post_block(post_path, short_block, is_markdown)
+				short_html += short_block + "</div></div>" + "\n"
 
-				var rp_ts = strconv.FormatInt(get_post_ts(post_path, true), 10)
-				var rp_cats = ""
-
-				for c := range new_categories {
-
-					var cat = new_categories[c]
-
-					for l := range cat {
-						if (cat[l] == post_path) {
-							// add to rp_cats
-							rp_cats += "<a href=\"/categories/" + c + "\">" + c + "</a>"
-							break
-						}
-					}
-
-				}
+				var rp_ts = strconv.FormatInt(get_post_ts(ns, post_path), 10)
+				// the categories in the order of the categories: header, the rendered page is the same in each build
+				var rp_cats = categories_string
 
 				// replace the unique strings that represent the positions of these blocks
 				short_html = strings.Replace(short_html, "<!--######rp_ts######-->", rp_ts, 1)
@@ -184,7 +519,7 @@ func parse_post(post_path string, p string) {
 
 			}
 
-			full_html += line + "\n"
+			long_block += line + "\n"
 
 		}
 
@@ -212,13 +547,87 @@ func parse_post(post_path string, p string) {
 
 	}
 
-	short_posts[post_path] = short_html
-	new_content["url:/" + post_path] = full_html + "</div></div>"
+	var now = time.Now()
+
+	if (is_draft == false) {
+		// content_loop builds the content again at the time of the next scheduled or expiring post
+		if (post_date.After(now) == true && (ns.NextPublishChange.IsZero() == true || post_date.Before(ns.NextPublishChange) == true)) {
+			ns.NextPublishChange = post_date
+		}
+		if (expires.After(now) == true && (ns.NextPublishChange.IsZero() == true || expires.Before(ns.NextPublishChange) == true)) {
+			ns.NextPublishChange = expires
+		}
+	}
+
+	if (is_draft == true || post_date.After(now) == true || (expires.IsZero() == false && now.Before(expires) == false)) {
+		// remove the headers that were added while parsing
+		unpublish_post(ns, post_path)
+		return
+	}
+
+	if (full_html_started == false) {
+		// there is no long block
+		short_block = render_post_block(post_path, short_block, is_markdown)
+		short_html += short_block
+	} else {
+		full_html += render_post_block(post_path, long_block, is_markdown)
+	}
+
+	ns.ShortPosts[post_path] = short_html
+	ns.PostDescriptions[post_path] = strings.TrimSpace(short_block)
+	ns.Content["url:/" + post_path] = full_html + "</div></div>"
 
 	return
 
 }
 
+func unpublish_post(ns *SiteSnapshot, post_path string) {
+	// remove a post from the snapshot that is being built
+
+	delete(ns.PostsByDate, post_path)
+	delete(ns.Titles, post_path)
+	delete(ns.Content, "description:/" + post_path)
+	delete(ns.PostMtimes, post_path)
+
+	for c := range ns.Categories {
+
+		var cat_posts []string
+		for l := range ns.Categories[c] {
+			if (ns.Categories[c][l] != post_path) {
+				cat_posts = append(cat_posts, ns.Categories[c][l])
+			}
+		}
+
+		if (len(cat_posts) == 0) {
+			// the category is empty without this post
+			delete(ns.Categories, c)
+		} else {
+			ns.Categories[c] = cat_posts
+		}
+
+	}
+
+}
+
+func render_post_block(post_path string, block string, is_markdown bool) (string) {
+	// return the html of a short or long block
+
+	if (is_markdown == false) {
+		// the block is html
+		return block
+	}
+
+	var b bytes.Buffer
+	err := markdown.Convert([]byte(block), &b)
+	if (err != nil) {
+		fmt.Println("error rendering markdown for file:", post_path, err)
+		return block
+	}
+
+	return b.String()
+
+}
+
 func connection_count_loop() {
 
 	// keep a log of connection_count every 2 seconds
@@ -234,41 +643,80 @@ func connection_count_loop() {
 
 }
 
-func content_loop() {
+func content_loop(s *Site) {
 
-	if (sending_content != 0) {
-		// wait for content send routines
-		time.Sleep(time.Minute * 1)
-		go content_loop()
-		return
-	}
+	// content is built when the files in the posts directory change or a scheduled or expiring post changes
+	var last_fingerprint = ""
+	var built = false
 
-	// check for updated content
-	var update_content = false
+	for {
 
-	// check files in posts/
-	// and update template
-	err := filepath.Walk("posts", func(path string, info os.FileInfo, err error) error {
+		var fingerprint = content_fingerprint(s)
+		var now = time.Now()
+
+		var next_publish_change = s.Snapshot.Load().NextPublishChange
+
+		if (fingerprint != last_fingerprint || (next_publish_change.IsZero() == false && now.Before(next_publish_change) == false)) {
+			// build a new snapshot and replace the served snapshot with it
+			ns, build_err := build_content(s)
+			if (build_err != nil && built == false) {
+				// the site cannot be served without the template
+				fmt.Println(build_err)
+				os.Exit(1)
+			} else if (build_err != nil) {
+				// the template may be replaced with rm and cp, serve the current snapshot and build again after the next event
+				fmt.Println(build_err, "- the previous content is served")
+			} else {
+				s.Snapshot.Store(ns)
+				built = true
+				last_fingerprint = fingerprint
+			}
+			next_publish_change = s.Snapshot.Load().NextPublishChange
+		}
 
-		if err != nil {
-			return err
+		// wait for an inotify event or the poll interval
+		var wait = time.Second * time.Duration(config.ContentPollSeconds)
+		if (config.ContentPollSeconds <= 0) {
+			wait = time.Minute * 1
 		}
 
-		if (path != "posts") {
+		if (next_publish_change.IsZero() == false && next_publish_change.Sub(now) < wait) {
+			// wake at the time of the next scheduled or expiring post
+			wait = next_publish_change.Sub(now) + time.Second
+		}
 
-			if (strings.Index(path, ".blog") != len(path) - 5) {
-				//fmt.Println("not a .blog file: " + string(path))
-				return nil
+		select {
+		case <-s.ContentChanged:
+			// editors write many files and events in a burst, wait until there are no events for 500 milliseconds
+			var debounce = true
+			for (debounce == true) {
+				select {
+				case <-s.ContentChanged:
+				case <-time.After(time.Millisecond * 500):
+					debounce = false
+				}
 			}
+		case <-time.After(wait):
+		}
 
-			//fmt.Println("path:", path, info.Size())
+	}
 
-			var fc, rf_err = os.ReadFile(path)
-			if (content["url:/" + path] != string(fc) && rf_err == nil) {
-				parse_post(string(path), string(fc))
-				update_content = true
-			}
+}
+
+func content_fingerprint(s *Site) (string) {
+	// return the path, size and modification time of each .blog file in posts/ without reading the files
+	// and the hash of main/index.html with the included files
+
+	var fp = ""
+
+	err := filepath.Walk(s.PostsDirectory, func(path string, info os.FileInfo, err error) error {
+
+		if err != nil {
+			return err
+		}
 
+		if (strings.HasSuffix(path, ".blog") == true) {
+			fp += path + ":" + strconv.FormatInt(info.Size(), 10) + ":" + strconv.FormatInt(info.ModTime().UnixNano(), 10) + "\n"
 		}
 
 		return nil
@@ -279,801 +727,2169 @@ func content_loop() {
 		fmt.Println("filepath.Walk error:", err)
 	}
 
-	if (content["url_part_0:/"] == "" || update_content == true) {
-
-		// the url / is empty or there are new posts
+	// the template is small, hash it to find changes in main/index.html and each included file
+	index_html, index_err := read_template(s.TemplateDirectory, "index.html", 0)
+	if (index_err == nil) {
+		var h = sha256.Sum256([]byte(index_html))
+		fp += "main/index.html:" + hex.EncodeToString(h[:]) + "\n"
+	}
 
-		// read index.html
-		index_html, index_err := os.ReadFile("main/index.html")
-		if (index_err != nil) {
-			fmt.Println("main/index.html does not exist")
-			os.Exit(1)
-		}
+	return fp
 
-		// main/index.html was modified
-		// or there are posts that are new or modified
-		update_content = true
+}
 
-		new_content["header"] = ""
-		new_content["footer"] = ""
+func read_template(template_directory string, path string, depth int) (string, error) {
+	// read a template file in the template directory (main/) and replace each <!-- ######include file.html###### --> line with the file in the template directory
 
-		// create categories html
-		var categories_html = ""
+	b, err := os.ReadFile(template_directory + "/" + path)
+	if (err != nil) {
+		return "", err
+	}
 
-		// order new_categories by character
-		srr := make([]string, 0)
-		for k := range new_categories {
-			srr = append(srr, k)
-		}
+	var lines = strings.Split(string(b), "\n")
+	for l := range lines {
 
-		sort.Strings(srr)
+		var line = strings.TrimSpace(lines[l])
 
-		for k := range srr {
-			for d := range new_categories {
-				if (srr[k] == d) {
-					//var posts_in_cat = new_categories[d]
-					categories_html += "<a href=\"/categories/" + d + "\" class=\"categories_entry\">" + d + "</a>"
-					break
-				}
-			}
+		if (strings.Index(line, "<!-- ######include ") != 0 || strings.HasSuffix(line, "###### -->") == false) {
+			continue
 		}
 
-		// add all posts sorted by time to html blocks
-		var short_posts_html []string
-		var post_titles_html = ""
+		var include_path = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "<!-- ######include "), "###### -->"))
 
-		// order new_posts_by_date
-		sr := make([]int, 0)
-		for k := range new_posts_by_date {
-			sr = append(sr, int(new_posts_by_date[k].Unix()))
+		if (strings.Index(include_path, "..") != -1) {
+			fmt.Println("template include paths must be in " + template_directory + "/:", path, include_path)
+			lines[l] = ""
+			continue
 		}
 
-		sort.Ints(sr)
+		if (depth >= 8) {
+			fmt.Println("template includes are nested more than 8 times:", path, include_path)
+			lines[l] = ""
+			continue
+		}
 
-		// reverse the slice
-		rev_sr := make([]int, 0)
-		for k := range sr {
-			_ = k
+		inc, inc_err := read_template(template_directory, strings.TrimPrefix(include_path, "/"), depth + 1)
+		if (inc_err != nil) {
+			fmt.Println("template include error:", path, inc_err)
+			lines[l] = ""
+			continue
+		}
 
-			// add the last entry to rev_sr
-			rev_sr = append(rev_sr, sr[len(sr)-1])
-			// remove the last entry from sr
-			sr = sr[:len(sr)-1]
+		lines[l] = strings.TrimSuffix(inc, "\n")
 
-		}
+	}
 
-		var completed_new_posts_by_date_paths []string
-		var count = 0
-		for k := range rev_sr {
-			for d := range new_posts_by_date {
+	return strings.Join(lines, "\n"), nil
 
-				// find if path was already completed
-				var already_completed_path = false
-				for acpi := range completed_new_posts_by_date_paths {
-					if (completed_new_posts_by_date_paths[acpi] == d) {
-						already_completed_path = true
-					}
-				}
+}
 
-				if (rev_sr[k] == int(new_posts_by_date[d].Unix()) && already_completed_path == false) {
+func build_content(s *Site) (*SiteSnapshot, error) {
+	// build a new snapshot from the files in posts/ and main/index.html with the included files
+	// the snapshot is built from every file each time so removed posts are not in it
 
-					var post_path = d
-					//var post_time = new_posts_by_date[d]
+	var ns = new_site_snapshot(s)
 
-					// get the index of this page
-					var short_posts_html_index = int(math.Floor(float64(count) / float64(config.RecentPostsCount)))
-					//fmt.Println("short_posts_html_index", short_posts_html_index, "post_path", post_path)
+	// read files in posts/
+	err := filepath.Walk(s.PostsDirectory, func(path string, info os.FileInfo, err error) error {
 
-					if (short_posts_html_index >= len(short_posts_html)) {
-						// create this page in short_posts_html
-						short_posts_html = append(short_posts_html, "")
-					}
+		if err != nil {
+			return err
+		}
 
-					// append to the array of short_posts_html with each item representing the configured number of recent posts per page
+		if (path != s.PostsDirectory) {
 
-					for p := range short_posts {
+			if (strings.Index(path, ".blog") != len(path) - 5) {
+				//fmt.Println("not a .blog file: " + string(path))
+				return nil
+			}
 
-						if (post_path == p) {
-							//short_posts_html += short_posts[p]
-							short_posts_html[short_posts_html_index] += short_posts[p]
-							break
-						}
+			//fmt.Println("path:", path, info.Size())
 
-					}
+			var fc, rf_err = os.ReadFile(path)
+			if (rf_err == nil) {
+				// posts are served from /posts/ for every posts directory
+				rel, _ := filepath.Rel(s.PostsDirectory, path)
+				var post_path = "posts/" + filepath.ToSlash(rel)
+				ns.PostMtimes[post_path] = info.ModTime()
+				parse_post(ns, post_path, string(fc))
+			}
 
-					if (count < config.RecentPostsTitlesCount) {
+		}
 
-						// only place the configured number of most recent posts in post_titles_html
+		return nil
 
-						for t := range new_titles {
+	})
 
-							if (post_path == t) {
-								post_titles_html += "<a href=\"/" + t + "\" class=\"post_titles_entry\">" + new_titles[t] + "</a>"
-								break
-							}
+	if err != nil {
+		fmt.Println("filepath.Walk error:", err)
+	}
 
-						}
+	// read index.html
+	index_html, index_err := read_template(s.TemplateDirectory, "index.html", 0)
+	if (index_err != nil) {
+		return nil, errors.New(s.TemplateDirectory + "/index.html does not exist")
+	}
 
-					}
+	// create categories html
+	var categories_html = ""
 
-					count += 1
+	// order categories by character
+	srr := make([]string, 0)
+	for k := range ns.Categories {
+		srr = append(srr, k)
+	}
 
-					// add to completed_new_posts_by_date_paths to allow posts with the same timestamp to be processed
-					completed_new_posts_by_date_paths = append(completed_new_posts_by_date_paths, post_path)
+	sort.Strings(srr)
 
-					break
-				}
+	for k := range srr {
+		for d := range ns.Categories {
+			if (srr[k] == d) {
+				//var posts_in_cat = ns.Categories[d]
+				categories_html += "<a href=\"" + html.EscapeString(category_path(d)) + "\" class=\"categories_entry\">" + html.EscapeString(d) + "</a>"
+				break
 			}
 		}
+	}
 
-		// add sections to index_html
-		var new_index_html = ""
-		var header = ""
-		var footer = ""
-		var header_footer_flip = false
-		var lines = strings.Split(string(index_html), "\n")
-		for l := range(lines) {
+	// add all posts sorted by time to html blocks
+	var short_posts_html []string
+	var post_titles_html = ""
 
-			var line = lines[l]
+	// order posts by date
+	sr := make([]int, 0)
+	for k := range ns.PostsByDate {
+		sr = append(sr, int(ns.PostsByDate[k].Unix()))
+	}
 
-			if (line == "<!-- ######categories###### -->") {
+	sort.Ints(sr)
 
-				// add all the categories
-				lines[l] = categories_html
+	// reverse the slice
+	rev_sr := make([]int, 0)
+	for k := range sr {
+		_ = k
 
-			} else if (line == "<!-- ######posts###### -->") {
+		// add the last entry to rev_sr
+		rev_sr = append(rev_sr, sr[len(sr)-1])
+		// remove the last entry from sr
+		sr = sr[:len(sr)-1]
 
-				// leave this line to be replaced with each page data
-				lines[l] = line
+	}
 
-				// stop adding to the header after this
-				// to replace this segment with content if not index.html
-				header_footer_flip = true
+	// posts with the same timestamp are ordered by path, the rendered pages are the same in each build
+	var date_paths []string
+	for d := range ns.PostsByDate {
+		date_paths = append(date_paths, d)
+	}
+	sort.Strings(date_paths)
 
-			} else if (line == "<!-- ######post_titles###### -->") {
+	var completed_post_paths []string
+	var count = 0
+	for k := range rev_sr {
+		for dp := range date_paths {
 
-				// add all posts
-				lines[l] = post_titles_html
+			var d = date_paths[dp]
 
+			// find if path was already completed
+			var already_completed_path = false
+			for acpi := range completed_post_paths {
+				if (completed_post_paths[acpi] == d) {
+					already_completed_path = true
+				}
 			}
 
-			if (line != "<!-- ######posts###### -->") {
+			if (rev_sr[k] == int(ns.PostsByDate[d].Unix()) && already_completed_path == false) {
 
-				// all lines except this one are added to the header and footer
-				// and this line flips them
+				var post_path = d
+				//var post_time = ns.PostsByDate[d]
 
-				if (header_footer_flip == false) {
-					header += line + "\n"
-				} else {
-					footer += line + "\n"
-				}
+				// get the index of this page
+				var short_posts_html_index = int(math.Floor(float64(count) / float64(s.RecentPostsCount)))
+				//fmt.Println("short_posts_html_index", short_posts_html_index, "post_path", post_path)
 
-			}
+				if (short_posts_html_index >= len(short_posts_html)) {
+					// create this page in short_posts_html
+					short_posts_html = append(short_posts_html, "")
+				}
 
-			new_index_html += lines[l] + "\n"
+				// append to the array of short_posts_html with each item representing the configured number of recent posts per page
 
-		}
+				for p := range ns.ShortPosts {
 
-		// add new_index_html as / in two parts
-		var slash_parts = strings.Split(new_index_html, "<!-- ######posts###### -->")
+					if (post_path == p) {
+						//short_posts_html += ns.ShortPosts[p]
+						short_posts_html[short_posts_html_index] += ns.ShortPosts[p]
+						break
+					}
 
-		if (len(slash_parts) == 2) {
-			// add both parts
-			new_content["url_part_0:/"] = slash_parts[0]
-			new_content["url_part_1:/"] = slash_parts[1]
-		} else {
-			// add first part only
-			new_content["url_part_0:/"] = slash_parts[0]
-			new_content["url_part_1:/"] = ""
-		}
+				}
 
-		// open page_links element
-		new_content["url_part_0:/"] += "<div id=\"page_links\">\n"
+				if (count < s.RecentPostsTitlesCount) {
 
-		// add each most recent posts page
-		for p := range(short_posts_html) {
-			// add each page link
-			new_content["url_part_0:/"] += "<a href=\"/?page=" + strconv.Itoa(p) + "\">Page " + strconv.Itoa(p) + "</a>\n"
-			// add each page content
-			new_content["page:" + strconv.Itoa(p)] = short_posts_html[p]
-		}
+					// only place the configured number of most recent posts in post_titles_html
 
-		// close page_links element
-		new_content["url_part_0:/"] += "</div>\n"
+					for t := range ns.Titles {
 
-		// add categories and post_titles to header and footer
-		header = strings.Replace(header, "<!-- ######categories###### -->", categories_html, 1)
-		header = strings.Replace(header, "<!-- ######post_titles###### -->", post_titles_html, 1)
-		footer = strings.Replace(footer, "<!-- ######categories###### -->", categories_html, 1)
-		footer = strings.Replace(footer, "<!-- ######post_titles###### -->", post_titles_html, 1)
+						if (post_path == t) {
+							post_titles_html += "<a href=\"" + html.EscapeString(escape_path("/" + t)) + "\" class=\"post_titles_entry\">" + html.EscapeString(ns.Titles[t]) + "</a>"
+							break
+						}
 
-		new_content["header"] = header
-		new_content["footer"] = footer
+					}
 
-	}
+				}
 
-	if (update_content == true) {
+				count += 1
 
-		// set updating_content to true
-		updating_content = true
+				// add to completed_post_paths to allow posts with the same timestamp to be processed
+				completed_post_paths = append(completed_post_paths, post_path)
 
-		// delete short_posts
-		for l := range short_posts {
-			delete(short_posts, l)
+				break
+			}
 		}
+	}
 
-		// delete categories 
-		for l := range categories {
-			delete(categories, l)
-		}
+	// add sections to index_html
+	var new_index_html = ""
+	var header = ""
+	var footer = ""
+	var header_footer_flip = false
+	var lines = strings.Split(string(index_html), "\n")
+	for l := range(lines) {
 
-		// delete posts_by_date
-		for l := range posts_by_date {
-			delete(posts_by_date, l)
-		}
+		var line = lines[l]
 
-		// delete titles
-		for l := range titles {
-			delete(titles, l)
-		}
+		if (line == "<!-- ######categories###### -->") {
 
-		// delete content
-		for l := range content {
-			delete(content, l)
-		}
+			// add all the categories
+			lines[l] = categories_html
 
-		// update categories map
-		for l := range new_categories {
+		} else if (line == "<!-- ######posts###### -->") {
 
-			if (len(new_categories[l]) == 0) {
-				// delete empty map value from categories
-				delete(categories, l)
-			} else {
-				// copy new_categories map value to categories map
-				categories[l] = new_categories[l]
-			}
+			// leave this line to be replaced with each page data
+			lines[l] = line
+
+			// stop adding to the header after this
+			// to replace this segment with content if not index.html
+			header_footer_flip = true
 
-			// delete map value from new_categories
-			delete(new_categories, l)
+		} else if (line == "<!-- ######post_titles###### -->") {
+
+			// add all posts
+			lines[l] = post_titles_html
 
 		}
 
-		// update posts_by_date map
-		for l := range new_posts_by_date {
+		if (line != "<!-- ######posts###### -->") {
+
+			// all lines except this one are added to the header and footer
+			// and this line flips them
 
-			if (new_posts_by_date[l] == time.Time{}) {
-				// delete empty map value from posts_by_date
-				delete(posts_by_date, l)
+			if (header_footer_flip == false) {
+				header += line + "\n"
 			} else {
-				// copy new_posts_by_date map value to posts_by_date map
-				posts_by_date[l] = new_posts_by_date[l]
+				footer += line + "\n"
 			}
 
-			// delete map value from new_posts_by_date
-			delete(new_posts_by_date, l)
+		}
+
+		new_index_html += lines[l] + "\n"
+
+	}
+
+	// add new_index_html as / in two parts
+	var slash_parts = strings.Split(new_index_html, "<!-- ######posts###### -->")
+
+	if (len(slash_parts) == 2) {
+		// add both parts
+		ns.Content["url_part_0:/"] = slash_parts[0]
+		ns.Content["url_part_1:/"] = slash_parts[1]
+	} else {
+		// add first part only
+		ns.Content["url_part_0:/"] = slash_parts[0]
+		ns.Content["url_part_1:/"] = ""
+	}
 
+	// open page_links element
+	ns.Content["url_part_0:/"] += "<div id=\"page_links\">\n"
+
+	// add each most recent posts page
+	for p := range(short_posts_html) {
+		// add each page link
+		ns.Content["url_part_0:/"] += "<a href=\"/?page=" + strconv.Itoa(p) + "\">Page " + strconv.Itoa(p) + "</a>\n"
+		// add each page content
+		ns.Content["page:" + strconv.Itoa(p)] = short_posts_html[p]
+	}
+
+	// close page_links element
+	ns.Content["url_part_0:/"] += "</div>\n"
+
+	// add the feeds of all posts
+	add_feeds(ns, "/", site_title(s), "/", completed_post_paths)
+
+	// add the feeds of each category
+	for c := range ns.Categories {
+
+		// posts in the category ordered by date
+		var cat_post_paths []string
+		for k := range completed_post_paths {
+			for l := range ns.Categories[c] {
+				if (ns.Categories[c][l] == completed_post_paths[k]) {
+					cat_post_paths = append(cat_post_paths, completed_post_paths[k])
+					break
+				}
+			}
 		}
 
-		// update titles map
-		for l := range new_titles {
+		add_feeds(ns, "/categories/" + c + "/", site_title(s) + " - " + c, category_path(c), cat_post_paths)
 
-			if (new_titles[l] == "") {
-				// delete empty map value from titles
-				delete(titles, l)
-			} else {
-				// copy new_titles map value to titles map
-				titles[l] = new_titles[l]
+	}
+
+	// add the sitemap and the robots.txt that is served when main/robots.txt does not exist
+	ns.Content["url:/sitemap.xml"] = sitemap(ns, completed_post_paths, len(short_posts_html))
+	ns.Content["url:/robots.txt"] = robots_txt(s)
+
+	// add categories and post_titles to header and footer
+	header = strings.Replace(header, "<!-- ######categories###### -->", categories_html, 1)
+	header = strings.Replace(header, "<!-- ######post_titles###### -->", post_titles_html, 1)
+	footer = strings.Replace(footer, "<!-- ######categories###### -->", categories_html, 1)
+	footer = strings.Replace(footer, "<!-- ######post_titles###### -->", post_titles_html, 1)
+
+	ns.Content["header"] = header
+	ns.Content["footer"] = footer
+
+	// posts that were removed or renamed since the last snapshot and the configured gonePosts are gone
+	var previous = s.Snapshot.Load()
+	if (previous != nil) {
+
+		for l := range previous.ShortPosts {
+			if (ns.Content["url:/" + l] == "") {
+				ns.Gone["/" + l] = true
 			}
+		}
+
+		for l := range previous.Gone {
+			if (ns.Content["url:" + l] == "") {
+				ns.Gone[l] = true
+			}
+		}
 
-			// delete map value from new_titles
-			delete(new_titles, l)
+	}
 
+	for l := range s.GonePosts {
+		var gone_path = "/" + strings.TrimPrefix(s.GonePosts[l], "/")
+		if (ns.Content["url:" + gone_path] == "") {
+			ns.Gone[gone_path] = true
 		}
+	}
 
-		// update content map
-		for l := range new_content {
+	render_pages(ns, previous, len(short_posts_html))
 
-			//fmt.Println(l, new_content[l])
+	return ns, nil
 
-			if (new_content[l] == "") {
-				// delete empty map value from content
-				delete(content, l)
-			} else {
-				// copy new_content map value to content map
-				content[l] = new_content[l]
+}
+
+type HttpRequest struct {
+	Method				string
+	Path				string
+	Proto				string
+	// header names are lower case
+	Headers				map[string] string
+	Body				[]byte
+}
+
+type HttpResponse struct {
+	// the status code and reason phrase, 200 or 410 Gone
+	Status				string
+	Headers				[]byte
+	Body				[]byte
+	// sent after Body when it is not nil
+	File				*os.File
+	FileSize			int64
+	// the parts of File sent in a 206 response, the whole file is sent when there are none
+	Ranges				[]FileRange
+	// sent after the ranges of a multipart/byteranges response
+	Trailer				[]byte
+}
+
+type FileRange struct {
+	// the multipart headers before the range
+	Header				[]byte
+	Offset				int64
+	Length				int64
+}
+
+var err_headers_too_long = errors.New("headers too long")
+var err_body_too_long = errors.New("body too long")
+var err_length_required = errors.New("length required")
+var err_invalid_request = errors.New("invalid request")
+
+func handle_http_request(conn net.Conn) {
+	// serve requests on a persistent connection until the client closes it, the idle timeout or the request limit
+
+	var idle_timeout = get_idle_timeout()
+
+	var max_requests = config.MaxRequestsPerConnection
+	if (max_requests <= 0) {
+		max_requests = 100
+	}
+
+	// pipelined requests remain in the reader after the previous request
+	var r = bufio.NewReaderSize(conn, 2048)
+
+	for request_count := 1; request_count <= max_requests; request_count++ {
+
+		// the idle timeout is the time allowed to send each request
+		conn.SetReadDeadline(time.Now().Add(idle_timeout))
+
+		req, req_err := read_http_request(r)
+
+		if (req_err == err_headers_too_long || req_err == err_body_too_long) {
+			conn.SetWriteDeadline(time.Now().Add(idle_timeout))
+			conn.Write([]byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+			break
+		} else if (req_err == err_length_required) {
+			conn.SetWriteDeadline(time.Now().Add(idle_timeout))
+			conn.Write([]byte("HTTP/1.1 411 Length Required\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+			break
+		} else if (req_err != nil) {
+			// invalid request, timeout or the connection was closed
+			//fmt.Println("http/s server read error:", req_err)
+			break
+		}
+
+		var keep_alive = request_count < max_requests
+
+		if (req.Proto == "HTTP/1.0") {
+			// HTTP/1.0 connections are closed unless the client asks to keep them open
+			keep_alive = keep_alive && strings.ToLower(req.Headers["connection"]) == "keep-alive"
+		} else if (strings.ToLower(req.Headers["connection"]) == "close") {
+			keep_alive = false
+		}
+
+		var res = serve_http_request(req)
+
+		var write_err = write_http_response(conn, req, res, keep_alive, idle_timeout)
+
+		if (write_err != nil || keep_alive == false) {
+			break
+		}
+
+	}
+
+	conn.Close()
+
+}
+
+func render_pages(ns *SiteSnapshot, previous *SiteSnapshot, pages int) {
+	// render each page, category, post and feed with the ETag of the content
+
+	var add_page = func(key string, content_type string, body string) {
+
+		var h = sha256.Sum256([]byte(body))
+		var page = Page{Body: []byte(body), ContentType: content_type, ETag: "\"" + hex.EncodeToString(h[:16]) + "\"", LastModified: time.Now()}
+
+		if (previous != nil && previous.Pages[key] != nil && previous.Pages[key].ETag == page.ETag) {
+			// the page did not change, use the compressed bodies of the previous snapshot
+			page.LastModified = previous.Pages[key].LastModified
+			page.GzipBody = previous.Pages[key].GzipBody
+			page.BrotliBody = previous.Pages[key].BrotliBody
+		} else {
+			// pages are compressed once for each change
+			page.GzipBody = compress_body(page.Body, "gzip", gzip.BestCompression)
+			page.BrotliBody = compress_body(page.Body, "br", 9)
+		}
+
+		ns.Pages[key] = &page
+
+	}
+
+	// each page of the most recent posts, the first page exists without posts
+	for p := 0; p < pages || p == 0; p++ {
+
+		var page_title = site_title(ns.Site)
+		var canonical_path = "/"
+		if (p != 0) {
+			page_title += " - Page " + strconv.Itoa(p)
+			canonical_path = "/?page=" + strconv.Itoa(p)
+		}
+
+		add_page("/?page=" + strconv.Itoa(p), "text/html", fill_page_head(ns.Content["url_part_0:/"], page_title, page_meta(ns.Site, page_title, ns.Site.Description, canonical_path, "website", time.Time{})) + ns.Content["page:" + strconv.Itoa(p)] + ns.Content["url_part_1:/"])
+
+	}
+
+	// each category
+	for cat := range ns.Categories {
+
+		var page_title = cat + " - " + site_title(ns.Site)
+		var s = fill_page_head(ns.Content["header"], page_title, page_meta(ns.Site, page_title, "Posts in " + cat, category_path(cat), "website", time.Time{}))
+
+		s += "<span class=\"category_title\">" + html.EscapeString(cat) + "</span>"
+		for c := range ns.Categories[cat] {
+			var post_path = ns.Categories[cat][c]
+
+			var title = get_post_title(ns, post_path)
+			var ts = strconv.FormatInt(get_post_ts(ns, post_path), 10)
+
+			s += "<div class=\"category_post_entry\"><a href=\"" + html.EscapeString(escape_path("/" + post_path)) + "\" class=\"category_post_link\">" + html.EscapeString(title) + "</a><span class=\"unix_ts category_post_date\">" + ts + "</span></div>"
+		}
+
+		add_page("/categories/" + cat, "text/html", s + ns.Content["footer"])
+
+	}
+
+	// each post
+	for post_path := range ns.ShortPosts {
+
+		var page_title = get_post_title(ns, post_path)
+
+		var description = ns.Content["description:/" + post_path]
+		if (description == "") {
+			description = ns.Site.Description
+		}
+
+		add_page("/" + post_path, "text/html", fill_page_head(ns.Content["header"], page_title, page_meta(ns.Site, page_title, description, escape_path("/" + post_path), "article", ns.PostsByDate[post_path])) + ns.Content["url:/" + post_path] + ns.Content["footer"])
+
+	}
+
+	// each feed
+	for k := range ns.Content {
+		if (strings.Index(k, "url:") == 0 && feed_content_type(k) != "") {
+			add_page(strings.TrimPrefix(k, "url:"), feed_content_type(k), ns.Content[k])
+		}
+	}
+
+	add_page("/sitemap.xml", "application/xml; charset=utf-8", ns.Content["url:/sitemap.xml"])
+	add_page("/robots.txt", "text/plain; charset=utf-8", ns.Content["url:/robots.txt"])
+
+}
+
+// text files in main/ that are compressed
+var compressible_extensions = map[string] bool{"html": true, "htm": true, "css": true, "js": true, "mjs": true, "json": true, "map": true, "svg": true, "txt": true, "xml": true, "webmanifest": true}
+
+func accepted_encoding(req HttpRequest) (string) {
+	// return br, gzip or an empty string from the Accept-Encoding request header
+
+	var br = false
+	var gz = false
+
+	var encodings = strings.Split(req.Headers["accept-encoding"], ",")
+	for e := range encodings {
+
+		var parts = strings.Split(encodings[e], ";")
+		var name = strings.ToLower(strings.TrimSpace(parts[0]))
+
+		// q=0 means not acceptable
+		var acceptable = true
+		for p := 1; p < len(parts); p++ {
+			var param = strings.TrimSpace(parts[p])
+			if (strings.Index(param, "q=") == 0) {
+				q, q_err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if (q_err == nil && q <= 0) {
+					acceptable = false
+				}
 			}
+		}
 
-			// delete map value from new_content
-			delete(new_content, l)
+		if (acceptable == true && name == "br") {
+			br = true
+		} else if (acceptable == true && (name == "gzip" || name == "x-gzip")) {
+			gz = true
+		}
+
+	}
+
+	// brotli is smaller
+	if (br == true) {
+		return "br"
+	} else if (gz == true) {
+		return "gzip"
+	}
+
+	return ""
+
+}
 
+func compress_body(body []byte, encoding string, level int) ([]byte) {
+	// compress with br or gzip at the level
+
+	var b bytes.Buffer
+
+	if (encoding == "br") {
+		var w = brotli.NewWriterLevel(&b, level)
+		w.Write(body)
+		w.Close()
+	} else {
+		w, err := gzip.NewWriterLevel(&b, level)
+		if (err != nil) {
+			w = gzip.NewWriter(&b)
 		}
+		w.Write(body)
+		w.Close()
+	}
+
+	return b.Bytes()
+
+}
 
-		// set updating_content to false
-		updating_content = false
+func encoded_etag(etag string, encoding string) (string) {
+	// each encoding of the same content has a different ETag
 
+	return strings.TrimSuffix(etag, "\"") + "-" + encoding + "\""
+
+}
+
+func get_idle_timeout() (time.Duration) {
+
+	if (config.IdleTimeoutSeconds <= 0) {
+		return time.Second * 5
 	}
 
-	time.Sleep(time.Minute * 1)
+	return time.Second * time.Duration(config.IdleTimeoutSeconds)
 
-	go content_loop()
+}
 
+// HTTP/2 connections are sent to the net/http server with a ConnListener
+type ConnListener struct {
+	Conns				chan net.Conn
+	ListenAddr			net.Addr
 }
 
-func handle_http_request(conn net.Conn) {
+func (l ConnListener) Accept() (net.Conn, error) {
+
+	c, ok := <-l.Conns
+	if (ok == false) {
+		return nil, net.ErrClosed
+	}
+
+	return c, nil
+
+}
+
+func (l ConnListener) Close() (error) {
+	return nil
+}
+
+func (l ConnListener) Addr() (net.Addr) {
+	return l.ListenAddr
+}
+
+func handle_h2_request(w http.ResponseWriter, r *http.Request) {
+	// serve an HTTP/2 request with the same routing as HTTP/1.1 requests
+
+	var req HttpRequest
+	req.Method = r.Method
+	req.Path = r.URL.RequestURI()
+	req.Proto = r.Proto
+	req.Headers = make(map[string] string)
+
+	for k := range r.Header {
+		req.Headers[strings.ToLower(k)] = strings.Join(r.Header[k], ", ")
+	}
+
+	// the :authority pseudo header
+	req.Headers["host"] = r.Host
+
+	if (r.Body != nil) {
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, 2001))
+		if (err != nil) {
+			return
+		}
+
+		if (len(body) > 2000) {
+			// body is too long
+			w.WriteHeader(400)
+			return
+		}
+
+		req.Body = body
+
+	}
+
+	var res = serve_http_request(req)
 
-	// if changes to memory from files are processing, wait for the updated content map
-	if (updating_content == true) {
-		time.Sleep(time.Millisecond * 200)
-		// try again
-		handle_http_request(conn)
+	if (res.File != nil) {
+		defer res.File.Close()
+	}
+
+	// add the response headers, Connection and Keep-Alive are not allowed in HTTP/2
+	var header_lines = strings.Split(string(res.Headers), "\r\n")
+	for l := range header_lines {
+
+		var colon = strings.Index(header_lines[l], ":")
+		if (colon == -1) {
+			continue
+		}
+
+		w.Header().Add(strings.TrimSpace(header_lines[l][:colon]), strings.TrimSpace(header_lines[l][colon + 1:]))
+
+	}
+
+	if (strings.Index(res.Status, "304") != 0) {
+		w.Header().Set("Content-Length", strconv.FormatInt(response_length(res), 10))
+	}
+
+	status_code, status_err := strconv.Atoi(strings.SplitN(res.Status, " ", 2)[0])
+	if (status_err != nil) {
+		status_code = 500
+	}
+
+	w.WriteHeader(status_code)
+
+	if (req.Method == "HEAD") {
+		// the headers are sent without the body
 		return
 	}
 
-	// parse HTTP/S request
+	w.Write(res.Body)
+
+	write_file_ranges(w, res)
+
+}
+
+func read_http_request(r *bufio.Reader) (HttpRequest, error) {
+	// read a request line, headers and the body with a Content-Length
+
+	var req HttpRequest
+	req.Headers = make(map[string] string)
+
 	var tlen = 0
-	var header_data []byte
-	var body_data []byte
-	var end_of_header = false
-	var content_length = -1
-	var read_body_data = false
+	var lines []string
 
 	// read header data
 	for true {
 
-		// set the read timeout for each read
-		conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+		line, err := r.ReadSlice('\n')
+		tlen += len(line)
 
-		buf := make([]byte, 1500)
-		l, err := conn.Read(buf)
-
-		if (err != nil) {
+		if (err == bufio.ErrBufferFull || tlen > 2000) {
+			// headers too long
+			return req, err_headers_too_long
+		} else if (err != nil) {
 			// error reading request data
-			//fmt.Println("http/s server read error:", err)
+			return req, err
+		}
+
+		var l = strings.TrimRight(string(line), "\r\n")
+
+		if (l == "") {
+			if (len(lines) == 0) {
+				// empty lines before a request are allowed
+				continue
+			}
+			// end of the headers
 			break
 		}
 
-		tlen += l
+		lines = append(lines, l)
 
-		if (tlen > 2000) {
-			// headers too long
-			conn.Write([]byte("HTTP/1.1 400 headers too long\r\n\r\n"))
-			conn.Close()
-			return
+	}
+
+	var first_line_space_split = strings.Split(lines[0], " ")
+
+	if (len(first_line_space_split) < 3) {
+		// invalid request
+		// should be similar to GET / HTTP/1.1
+		return req, err_invalid_request
+	}
+
+	req.Method = first_line_space_split[0]
+	// the second item is the path
+	req.Path = first_line_space_split[1]
+	req.Proto = first_line_space_split[2]
+
+	for l := 1; l < len(lines); l++ {
+
+		var colon = strings.Index(lines[l], ":")
+		if (colon == -1) {
+			return req, err_invalid_request
+		}
+
+		req.Headers[strings.ToLower(strings.TrimSpace(lines[l][:colon]))] = strings.TrimSpace(lines[l][colon + 1:])
+
+	}
+
+	if (req.Headers["transfer-encoding"] != "") {
+		// the end of a chunked body is not known without reading it, a Content-Length is required
+		return req, err_length_required
+	}
+
+	if (req.Headers["content-length"] != "") {
+
+		content_length, cl_err := strconv.Atoi(req.Headers["content-length"])
+		if (cl_err != nil || content_length < 0) {
+			return req, err_invalid_request
+		}
+
+		if (content_length > 2000) {
+			// body is too long
+			return req, err_body_too_long
+		}
+
+		// read body data
+		req.Body = make([]byte, content_length)
+		_, err := io.ReadFull(r, req.Body)
+		if (err != nil) {
+			return req, err
+		}
+
+	}
+
+	return req, nil
+
+}
+
+func write_http_response(conn net.Conn, req HttpRequest, res HttpResponse, keep_alive bool, idle_timeout time.Duration) (error) {
+	// write the status line, headers with the Content-Length and the body or file
+
+	if (res.File != nil) {
+		defer res.File.Close()
+	}
+
+	var response_headers = res.Headers
+	if (strings.Index(res.Status, "304") != 0) {
+		// a 304 response has no body and the Content-Length would be the length of the 200 response
+		response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Length: " + strconv.FormatInt(response_length(res), 10) + "\r\n")}, nil)
+	}
+
+	if (keep_alive == true) {
+		response_headers = bytes.Join([][]byte{response_headers, []byte("Connection: keep-alive\r\n")}, nil)
+		response_headers = bytes.Join([][]byte{response_headers, []byte("Keep-Alive: timeout=" + strconv.FormatInt(int64(idle_timeout / time.Second), 10) + "\r\n")}, nil)
+	} else {
+		response_headers = bytes.Join([][]byte{response_headers, []byte("Connection: close\r\n")}, nil)
+	}
+
+	// a HEAD response has the headers and Content-Length of the GET response without the body
+	var body = res.Body
+	if (req.Method == "HEAD") {
+		body = nil
+	}
+
+	// write the headers and body with one write
+	conn.SetWriteDeadline(time.Now().Add(idle_timeout))
+	_, err := conn.Write(bytes.Join([][]byte{[]byte("HTTP/1.1 " + status_line(res.Status) + "\r\n"), response_headers, []byte("\r\n"), body}, nil))
+	if (err != nil) {
+		return err
+	}
+
+	if (req.Method == "HEAD") {
+		return nil
+	}
+
+	// the write deadline is for each write to allow large files
+	return write_file_ranges(DeadlineWriter{Conn: conn, Timeout: idle_timeout}, res)
+
+}
+
+type DeadlineWriter struct {
+	Conn				net.Conn
+	Timeout				time.Duration
+}
+
+func (w DeadlineWriter) Write(b []byte) (int, error) {
+
+	w.Conn.SetWriteDeadline(time.Now().Add(w.Timeout))
+	return w.Conn.Write(b)
+
+}
+
+func response_length(res HttpResponse) (int64) {
+	// return the Content-Length of the body, file ranges and trailer
+
+	var length = int64(len(res.Body)) + int64(len(res.Trailer))
+
+	if (res.File != nil && len(res.Ranges) == 0) {
+		length += res.FileSize
+	}
+
+	if (res.File != nil) {
+		for r := range res.Ranges {
+			length += int64(len(res.Ranges[r].Header)) + res.Ranges[r].Length
 		}
+	}
+
+	return length
+
+}
+
+func write_file_ranges(w io.Writer, res HttpResponse) (error) {
+	// write the file or each range of the file with the multipart headers and trailer
+
+	if (res.File == nil) {
+		return nil
+	}
+
+	var ranges = res.Ranges
+	if (len(ranges) == 0) {
+		ranges = []FileRange{FileRange{Offset: 0, Length: res.FileSize}}
+	}
+
+	b := make([]byte, 16384)
+
+	for r := range ranges {
+
+		if (len(ranges[r].Header) > 0) {
+			_, err := w.Write(ranges[r].Header)
+			if (err != nil) {
+				return err
+			}
+		}
+
+		_, seek_err := res.File.Seek(ranges[r].Offset, io.SeekStart)
+		if (seek_err != nil) {
+			return seek_err
+		}
+
+		// send content
+		var sent int64 = 0
+		for (sent < ranges[r].Length) {
+
+			n, read_err := res.File.Read(b)
+			if (n > 0) {
+
+				if (sent + int64(n) > ranges[r].Length) {
+					// the file is longer than the range
+					n = int(ranges[r].Length - sent)
+				}
+
+				_, err := w.Write(b[:n])
+				if (err != nil) {
+					return err
+				}
+
+				sent += int64(n)
+
+			}
+
+			if (read_err != nil) {
+				break
+			}
+
+		}
+
+		if (sent < ranges[r].Length) {
+			// the file is shorter than the Content-Length, the connection cannot be used for another request
+			return errors.New("file shorter than Content-Length")
+		}
+
+	}
+
+	if (len(res.Trailer) > 0) {
+		_, err := w.Write(res.Trailer)
+		return err
+	}
+
+	return nil
+
+}
+
+var err_range_not_satisfiable = errors.New("range not satisfiable")
+
+// more ranges are sent as the whole file
+var max_ranges = 16
+
+func parse_ranges(h string, size int64) ([]FileRange, error) {
+	// parse a Range request header of byte ranges in a file of size
+
+	if (strings.Index(h, "bytes=") != 0) {
+		return nil, err_invalid_request
+	}
+
+	var specs = strings.Split(strings.TrimPrefix(h, "bytes="), ",")
+	if (len(specs) > max_ranges) {
+		return nil, err_invalid_request
+	}
+
+	var ranges []FileRange
+
+	for sp := range specs {
+
+		var spec = strings.TrimSpace(specs[sp])
+		if (spec == "") {
+			continue
+		}
+
+		var dash = strings.Index(spec, "-")
+		if (dash == -1) {
+			return nil, err_invalid_request
+		}
+
+		var first_s = strings.TrimSpace(spec[:dash])
+		var last_s = strings.TrimSpace(spec[dash + 1:])
+
+		if (first_s == "") {
+
+			// bytes=-500 is the last 500 bytes
+			suffix, err := strconv.ParseInt(last_s, 10, 64)
+			if (err != nil || suffix < 0) {
+				return nil, err_invalid_request
+			}
+
+			if (suffix == 0 || size == 0) {
+				continue
+			}
+
+			if (suffix > size) {
+				suffix = size
+			}
+
+			ranges = append(ranges, FileRange{Offset: size - suffix, Length: suffix})
+			continue
+
+		}
+
+		first, err := strconv.ParseInt(first_s, 10, 64)
+		if (err != nil || first < 0) {
+			return nil, err_invalid_request
+		}
+
+		var last = size - 1
+		if (last_s != "") {
+			last, err = strconv.ParseInt(last_s, 10, 64)
+			if (err != nil || last < first) {
+				return nil, err_invalid_request
+			}
+			if (last >= size) {
+				last = size - 1
+			}
+		}
+
+		if (first >= size) {
+			// this range is not satisfiable
+			continue
+		}
+
+		ranges = append(ranges, FileRange{Offset: first, Length: last - first + 1})
+
+	}
+
+	if (len(ranges) == 0) {
+		return nil, err_range_not_satisfiable
+	}
+
+	return ranges, nil
+
+}
+
+func content_range(r FileRange, size int64) (string) {
+	// return the Content-Range of a range
+
+	return "bytes " + strconv.FormatInt(r.Offset, 10) + "-" + strconv.FormatInt(r.Offset + r.Length - 1, 10) + "/" + strconv.FormatInt(size, 10)
+
+}
+
+func if_range_matches(req HttpRequest, etag string, last_modified time.Time) (bool) {
+	// return true if there is no If-Range request header or it matches the current version
+
+	var ir = strings.TrimSpace(req.Headers["if-range"])
+
+	if (ir == "") {
+		return true
+	}
+
+	if (strings.Index(ir, "\"") == 0) {
+		// an ETag must be a strong match
+		return ir == etag
+	}
+
+	if (strings.Index(ir, "W/") == 0) {
+		return false
+	}
+
+	irt, err := http.ParseTime(ir)
+	if (err != nil) {
+		return false
+	}
+
+	return last_modified.Truncate(time.Second).Equal(irt)
+
+}
+
+func not_modified(req HttpRequest, etag string, last_modified time.Time) (bool) {
+	// return true if the If-None-Match or If-Modified-Since request headers match the current version
+
+	if (req.Headers["if-none-match"] != "") {
+
+		// If-Modified-Since is ignored when If-None-Match is sent
+		var tags = strings.Split(req.Headers["if-none-match"], ",")
+		for t := range tags {
+			var tag = strings.TrimPrefix(strings.TrimSpace(tags[t]), "W/")
+			if (tag == etag || tag == "*") {
+				return true
+			}
+		}
+
+		return false
+
+	}
+
+	if (req.Headers["if-modified-since"] != "") {
+
+		ims, err := http.ParseTime(req.Headers["if-modified-since"])
+		if (err == nil && last_modified.Truncate(time.Second).After(ims) == false) {
+			return true
+		}
+
+	}
+
+	return false
+
+}
+
+func file_content_type(f *os.File, ext string) (string) {
+	// return the Content-Type of a file from mime_types, the mime database or the content
+
+	var content_type = mime_types[ext]
+
+	if (content_type == "" && ext != "") {
+		content_type = mime.TypeByExtension("." + ext)
+	}
+
+	if (content_type == "") {
+
+		// sniff the first 512 bytes, application/octet-stream is returned if the content is not known
+		var b = make([]byte, 512)
+		n, _ := io.ReadFull(f, b)
+		content_type = http.DetectContentType(b[:n])
+		f.Seek(0, io.SeekStart)
+
+	}
+
+	// text is utf-8
+	var media_type = strings.ToLower(strings.TrimSpace(strings.Split(content_type, ";")[0]))
+	var is_text = strings.Index(media_type, "text/") == 0 || media_type == "application/json" || media_type == "application/javascript" || media_type == "application/xml" || strings.HasSuffix(media_type, "+json") || strings.HasSuffix(media_type, "+xml")
+
+	if (is_text == true && strings.Index(strings.ToLower(content_type), "charset=") == -1) {
+		content_type += "; charset=utf-8"
+	}
+
+	return content_type
+
+}
+
+// the methods that are answered, other methods are answered with 405 Method Not Allowed
+var allowed_methods = "GET, HEAD, OPTIONS"
+
+func serve_http_request(req HttpRequest) (HttpResponse) {
+	// route a request to the content or a file in the template directory of the site of the Host header
+
+	var res HttpResponse
+
+	var s = site_for_host(req.Headers["host"])
+	if (s == nil) {
+		// no site has the hostname and there is no default site
+		res.Status = "421 Misdirected Request"
+		res.Headers = add_error_page(nil, &res, nil)
+		return res
+	}
+
+	// the snapshot is not modified while it is used
+	var snapshot = s.Snapshot.Load()
+
+	// parse the url
+	urlp, urlp_err := url.Parse(req.Path)
+
+	if (urlp_err != nil) {
+		res.Status = "404 Not Found"
+		res.Headers = add_error_page(snapshot, &res, nil)
+		return res
+	}
+
+	var response_headers []byte
+
+	// add random length header to prevent length based resource guessing, there may be random length TLS padding, this fixes it regardless
+	// requests should be sent in a random order also
+	var rand_len = mrand.Intn(20)
+	var rl = ""
+	for r := 0; r<rand_len; r++ {
+		rl += "a"
+	}
+	response_headers = bytes.Join([][]byte{response_headers, []byte("RL: " + rl + "\r\n")}, nil)
+
+	response_headers = bytes.Join([][]byte{response_headers, security_headers(urlp.Path)}, nil)
+
+	var query = ""
+	if (urlp.RawQuery != "") {
+		query = "?" + urlp.RawQuery
+	}
+
+	if (redirect_to_canonical_host(s, req.Headers["host"]) == true) {
+
+		// an alias or another hostname, redirect to the same path and query at the first hostname of the site
+		response_headers = bytes.Join([][]byte{response_headers, []byte("Location: " + site_url(s) + escape_path(urlp.Path) + query + "\r\n")}, nil)
+		res.Status = "301 Moved Permanently"
+		res.Headers = response_headers
+		return res
+
+	}
+
+	if (config.RemoveTrailingSlash == true && len(urlp.Path) > 1 && urlp.Path[len(urlp.Path)-1] == 47 && strings.Index(urlp.Path, "/..") == -1) {
+
+		// /path/ is redirected to /path when /path is a page or a file, directories in main/ keep the trailing /
+		var trimmed = strings.TrimRight(urlp.Path, "/")
+
+		fi, fi_err := os.Stat(s.TemplateDirectory + trimmed)
+
+		if (trimmed != "" && (snapshot.Pages[trimmed] != nil || (fi_err == nil && fi.IsDir() == false))) {
+			response_headers = bytes.Join([][]byte{response_headers, []byte("Location: " + escape_path(trimmed) + query + "\r\n")}, nil)
+			res.Status = "301 Moved Permanently"
+			res.Headers = response_headers
+			return res
+		}
+
+	}
+
+	if (req.Method == "OPTIONS") {
+
+		// the methods that are allowed for every resource
+		response_headers = bytes.Join([][]byte{response_headers, []byte("Allow: " + allowed_methods + "\r\n")}, nil)
+		res.Status = "200"
+		res.Headers = response_headers
+		return res
+
+	} else if (req.Method != "GET" && req.Method != "HEAD") {
+
+		response_headers = bytes.Join([][]byte{response_headers, []byte("Allow: " + allowed_methods + "\r\n")}, nil)
+		res.Status = "405 Method Not Allowed"
+		res.Headers = add_error_page(snapshot, &res, response_headers)
+		return res
+
+	}
+
+	// pages are rendered when the snapshot is built
+	var page_key = urlp.Path
+	if (urlp.Path == "/" || urlp.Path == "") {
+
+		var p = urlp.Query().Get("page")
+
+		if (p == "") {
+			// first page is default
+			p = "0"
+		}
+		//fmt.Println("page", p)
+
+		// main view, paginated
+		page_key = "/?page=" + p
+
+	}
+
+	if (urlp.Path == "/robots.txt" && file_exists(s.TemplateDirectory + "/robots.txt") == true) {
+		// main/robots.txt is sent instead of the generated robots.txt
+		page_key = ""
+	}
+
+	if (snapshot.Pages[page_key] != nil) {
+
+		// a page, category, post, feed, sitemap or robots.txt
+		var page = snapshot.Pages[page_key]
+
+		response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: " + page.ContentType + "\r\n")}, nil)
+		response_headers = bytes.Join([][]byte{response_headers, []byte("Cache-Control: max-age=0\r\n")}, nil)
+		response_headers = bytes.Join([][]byte{response_headers, []byte("Vary: Accept-Encoding\r\n")}, nil)
+
+		// send the precompressed body that the client accepts
+		var body = page.Body
+		var etag = page.ETag
+		var encoding = accepted_encoding(req)
+
+		if (encoding == "br") {
+			body = page.BrotliBody
+		} else if (encoding == "gzip") {
+			body = page.GzipBody
+		}
+
+		if (encoding != "") {
+			response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Encoding: " + encoding + "\r\n")}, nil)
+			etag = encoded_etag(etag, encoding)
+		}
+
+		response_headers = bytes.Join([][]byte{response_headers, []byte("ETag: " + etag + "\r\n")}, nil)
+		response_headers = bytes.Join([][]byte{response_headers, []byte("Last-Modified: " + page.LastModified.UTC().Format(http.TimeFormat) + "\r\n")}, nil)
+
+		if (not_modified(req, etag, page.LastModified) == true) {
+			res.Status = "304 Not Modified"
+		} else {
+			res.Status = "200"
+			res.Body = body
+		}
+
+	} else if (urlp.Path == "/" || urlp.Path == "") {
+
+		// the page does not exist
+		res.Status = "404 Not Found"
+
+	} else if (strings.Index(urlp.Path, "/categories/") == 0) {
+
+		// the category does not exist
+		res.Status = "404 Not Found"
+
+	} else if (strings.Index(urlp.Path, "/posts/") == 0) {
+
+		// a post that is not in the snapshot
+		if (snapshot.Gone[urlp.Path] == true) {
+			// the post was removed
+			res.Status = "410 Gone"
+		} else {
+			// does not exist
+			res.Status = "404 Not Found"
+		}
+
+	} else if (strings.Index(urlp.Path, "/..") != -1) {
+
+		// invalid URL, someone is trying to access a file they should not be trying to access
+		res.Status = "401 Unauthorized"
+
+	} else {
+
+		fi, fi_err := os.Lstat(s.TemplateDirectory + urlp.Path)
+
+		var redirect = false
+
+		if (fi_err != nil) {
+
+			// file or directory not found
+			res.Status = "404 Not Found"
+
+		} else {
+
+			var continue_after_link = true
+
+			if (fi.Mode()&os.ModeSymlink != 0) {
+
+				// this is a link, find the target
+				continue_after_link = false
+				rpath, rl_err := os.Readlink(s.TemplateDirectory + urlp.Path)
+				if (rl_err != nil) {
+
+					// link has no target
+					res.Status = "404 Not Found"
+
+				} else {
+
+					// the target is real, solve if it is a directory or a file
+					// set fi to the real path
+					// links to links fail after the first link
+
+					fi, fi_err = os.Lstat(rpath)
+
+					if (fi_err != nil) {
+
+						// linked file or directory not found
+						res.Status = "404 Not Found"
+
+					} else {
+
+						if (fi.Mode()&os.ModeSymlink != 0) {
+
+							// link to a link
+							res.Status = "404 Not Found"
+
+						} else {
+
+							// link file or directory found
+							continue_after_link = true
+
+						}
+
+					}
+
+				}
+
+			}
+
+			if (fi_err == nil && fi.IsDir() == true && continue_after_link == true) {
+
+				// this is not a file, add index.html to the path
+				if (urlp.Path[len(urlp.Path)-1] == 47) {
+					urlp.Path += "index.html"
+				} else {
+					// must redirect to /
+					urlp.Path += "/"
+					redirect = true
+				}
+
+			}
+
+		}
+
+		if (redirect == true) {
+
+			// redirect to add / to end of path
+			// domain.tld/path was typed and must be domain.tld/path/
+			response_headers = bytes.Join([][]byte{response_headers, []byte("Location: " + escape_path(urlp.Path) + "\r\n")}, nil)
+			res.Status = "302 Found"
+
+		} else if (fi_err == nil && res.Status == "") {
+			// file or directory was found
+			// but it may be missing (this is the fastest way)
+			// because it could be index.html
+
+			// try to open file accessed by the browser, included in the /main directory
+			f, err := os.Open(s.TemplateDirectory + urlp.Path)
+
+			var f_fi os.FileInfo
+			if (err == nil) {
+				f_fi, err = f.Stat()
+				if (err != nil) {
+					f.Close()
+				}
+			}
+
+			if (err != nil && os.IsNotExist(err) == true) {
+
+				// file not found
+				//w.WriteHeader(http.StatusNotFound)
+				res.Status = "404 Not Found"
+
+			} else if (err != nil) {
+
+				// the file cannot be read
+				res.Status = "500 Internal Server Error"
+
+			} else {
+
+				// add cache headers for files, 1 hour
+				response_headers = bytes.Join([][]byte{response_headers, []byte("Cache-Control: max-age=3600\r\n")}, nil)
+
+				// the ETag of a file is the size and modification time
+				var etag = "\"" + strconv.FormatInt(f_fi.Size(), 16) + "-" + strconv.FormatInt(f_fi.ModTime().UnixNano(), 16) + "\""
+				var last_modified = f_fi.ModTime()
+
+				res.Status = "200"
+
+				// get extension
+				var ext = strings.ToLower(strings.TrimPrefix(filepath.Ext(urlp.Path), "."))
+				var content_type = file_content_type(f, ext)
+
+				// the file is sent by write_http_response unless it is compressed
+				res.File = f
+				res.FileSize = f_fi.Size()
+
+				var encoding = ""
+				if (compressible_extensions[ext] == true) {
+
+					response_headers = bytes.Join([][]byte{response_headers, []byte("Vary: Accept-Encoding\r\n")}, nil)
+					encoding = accepted_encoding(req)
+
+				}
+
+				if (encoding != "") {
+
+					// a file.css.br or file.css.gz next to file.css is sent instead of compressing file.css
+					var sibling_ext = ".br"
+					if (encoding == "gzip") {
+						sibling_ext = ".gz"
+					}
+
+					sf, sf_err := os.Open(s.TemplateDirectory + urlp.Path + sibling_ext)
+
+					var sf_fi os.FileInfo
+					if (sf_err == nil) {
+						sf_fi, sf_err = sf.Stat()
+						if (sf_err != nil) {
+							sf.Close()
+						}
+					}
+
+					if (sf_err == nil) {
+
+						// send the compressed sibling
+						f.Close()
+						res.File = sf
+						res.FileSize = sf_fi.Size()
+						etag = "\"" + strconv.FormatInt(sf_fi.Size(), 16) + "-" + strconv.FormatInt(sf_fi.ModTime().UnixNano(), 16) + "\""
+						if (sf_fi.ModTime().After(last_modified) == true) {
+							last_modified = sf_fi.ModTime()
+						}
+
+					} else if (f_fi.Size() <= 1024 * 1024) {
+
+						// compress the file
+						fc, fc_err := io.ReadAll(f)
+						if (fc_err == nil) {
+							f.Close()
+							res.File = nil
+							res.FileSize = 0
+							res.Body = compress_body(fc, encoding, 5)
+						} else {
+							// send the file without compression
+							f.Seek(0, io.SeekStart)
+							encoding = ""
+						}
+
+					} else {
+
+						// large files are not compressed
+						encoding = ""
+
+					}
+
+				}
+
+				if (encoding != "") {
+					response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Encoding: " + encoding + "\r\n")}, nil)
+					etag = encoded_etag(etag, encoding)
+				}
+
+				response_headers = bytes.Join([][]byte{response_headers, []byte("ETag: " + etag + "\r\n")}, nil)
+				response_headers = bytes.Join([][]byte{response_headers, []byte("Last-Modified: " + last_modified.UTC().Format(http.TimeFormat) + "\r\n")}, nil)
+
+				if (res.File != nil) {
+					// files compressed when they are sent have no byte ranges
+					response_headers = bytes.Join([][]byte{response_headers, []byte("Accept-Ranges: bytes\r\n")}, nil)
+				}
+
+				if (not_modified(req, etag, last_modified) == true) {
+
+					res.Status = "304 Not Modified"
+					res.Body = nil
+					if (res.File != nil) {
+						res.File.Close()
+						res.File = nil
+						res.FileSize = 0
+					}
+					response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: " + content_type + "\r\n")}, nil)
+
+				} else if (res.File != nil && req.Headers["range"] != "" && if_range_matches(req, etag, last_modified) == true) {
+
+					ranges, ranges_err := parse_ranges(req.Headers["range"], res.FileSize)
+
+					if (ranges_err == err_range_not_satisfiable) {
+
+						// the size of the representation the ranges apply to, the compressed sibling when it is sent
+						response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Range: bytes */" + strconv.FormatInt(res.FileSize, 10) + "\r\n")}, nil)
+						res.Status = "416 Range Not Satisfiable"
+						res.File.Close()
+						res.File = nil
+						res.FileSize = 0
+
+					} else if (ranges_err != nil) {
+
+						// an invalid Range header is ignored and the whole file is sent
+						response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: " + content_type + "\r\n")}, nil)
+
+					} else if (len(ranges) == 1) {
+
+						res.Status = "206 Partial Content"
+						res.Ranges = ranges
+						response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: " + content_type + "\r\n")}, nil)
+						response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Range: " + content_range(ranges[0], res.FileSize) + "\r\n")}, nil)
+
+					} else {
+
+						// each range is a part of a multipart/byteranges body
+						var boundary = strconv.FormatInt(mrand.Int63(), 36) + strconv.FormatInt(mrand.Int63(), 36)
+
+						for r := range ranges {
+							var part_header = "--" + boundary + "\r\nContent-Type: " + content_type + "\r\nContent-Range: " + content_range(ranges[r], res.FileSize) + "\r\n\r\n"
+							if (r > 0) {
+								part_header = "\r\n" + part_header
+							}
+							ranges[r].Header = []byte(part_header)
+						}
+
+						res.Status = "206 Partial Content"
+						res.Ranges = ranges
+						res.Trailer = []byte("\r\n--" + boundary + "--\r\n")
+						response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: multipart/byteranges; boundary=" + boundary + "\r\n")}, nil)
+
+					}
+
+				} else {
+
+					response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: " + content_type + "\r\n")}, nil)
+
+				}
+
+			}
+
+		}
+
+	}
+
+	res.Headers = add_error_page(snapshot, &res, response_headers)
+
+	return res
+
+}
+
+// sent with every response unless they are replaced in securityHeaders in config.json
+// Content-Security-Policy depends on the scripts, fonts and styles of main/index.html and is only sent when it is in securityHeaders.headers
+var default_security_headers = map[string] string{
+	"Strict-Transport-Security": "max-age=31536000",
+	"X-Content-Type-Options": "nosniff",
+	"Referrer-Policy": "strict-origin-when-cross-origin",
+	"Permissions-Policy": "camera=(), microphone=(), geolocation=()",
+}
+
+func security_headers(path string) ([]byte) {
+	// return the security response headers of a url path
+
+	var h = make(map[string] string)
+
+	for k := range default_security_headers {
+		h[http.CanonicalHeaderKey(k)] = default_security_headers[k]
+	}
+
+	for k := range config.SecurityHeaders.Headers {
+		h[http.CanonicalHeaderKey(k)] = config.SecurityHeaders.Headers[k]
+	}
+
+	// the longest path prefix replaces the headers
+	var longest_prefix = ""
+	var longest_key = ""
+	for p := range config.SecurityHeaders.Paths {
+		var prefix = "/" + strings.TrimPrefix(p, "/")
+		if (strings.Index(path, prefix) == 0 && len(prefix) > len(longest_prefix)) {
+			longest_prefix = prefix
+			longest_key = p
+		}
+	}
+
+	if (longest_prefix != "") {
+		for k := range config.SecurityHeaders.Paths[longest_key] {
+			h[http.CanonicalHeaderKey(k)] = config.SecurityHeaders.Paths[longest_key][k]
+		}
+	}
+
+	// sort the names so each response has the same order
+	var names []string
+	for k := range h {
+		if (h[k] != "") {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var b []byte
+	for n := range names {
+		b = bytes.Join([][]byte{b, []byte(names[n] + ": " + h[names[n]] + "\r\n")}, nil)
+	}
+
+	return b
+
+}
+
+func status_line(status string) (string) {
+	// return the status code with the reason phrase, 404 Not Found
+
+	if (strings.Index(status, " ") != -1) {
+		return status
+	}
+
+	code, err := strconv.Atoi(status)
+	if (err != nil) {
+		return status
+	}
+
+	return status + " " + http.StatusText(code)
+
+}
+
+func add_error_page(snapshot *SiteSnapshot, res *HttpResponse, response_headers []byte) ([]byte) {
+	// set the body of an error response without a body to the error page and return the response headers
+
+	code, err := strconv.Atoi(strings.SplitN(res.Status, " ", 2)[0])
+	if (err != nil || code < 400 || res.Body != nil || res.File != nil) {
+		return response_headers
+	}
+
+	// the headers of the file are not the headers of the error page, a 416 response keeps Content-Range
+	response_headers = remove_headers(response_headers, "content-encoding", "etag", "last-modified", "accept-ranges", "vary", "content-type", "cache-control")
+
+	response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: text/html; charset=utf-8\r\n")}, nil)
+	response_headers = bytes.Join([][]byte{response_headers, []byte("Cache-Control: no-cache\r\n")}, nil)
+
+	res.Body = []byte(error_page(snapshot, status_line(res.Status)))
+
+	return response_headers
+
+}
+
+func remove_headers(response_headers []byte, names ...string) ([]byte) {
+	// return the response headers without the headers with the lower case names
+
+	var kept []byte
+
+	var lines = bytes.SplitAfter(response_headers, []byte("\r\n"))
+	for l := range lines {
+
+		var colon = bytes.IndexByte(lines[l], ':')
+		var remove = false
+
+		if (colon != -1) {
+			var name = strings.ToLower(strings.TrimSpace(string(lines[l][:colon])))
+			for n := range names {
+				if (names[n] == name) {
+					remove = true
+				}
+			}
+		}
+
+		if (remove == false) {
+			kept = bytes.Join([][]byte{kept, lines[l]}, nil)
+		}
+
+	}
+
+	return kept
+
+}
+
+func error_page(snapshot *SiteSnapshot, status string) (string) {
+	// render main/404.html (or the file of the status code) or the error block between the header and footer of main/index.html
+
+	var code = strings.SplitN(status, " ", 2)[0]
+	var error_html = "<div class=\"error\"><span class=\"error_title\">" + html.EscapeString(status) + "</span></div>\n"
+
+	if (snapshot == nil) {
+		// the request is not for a site
+		return error_html
+	}
+
+	if (file_exists(snapshot.Site.TemplateDirectory + "/" + code + ".html") == true) {
+
+		ep, ep_err := read_template(snapshot.Site.TemplateDirectory, code + ".html", 0)
+		if (ep_err == nil) {
+			ep = fill_page_head(ep, status, "")
+			return strings.Replace(ep, "<!-- ######error###### -->", error_html, 1)
+		}
+
+	}
+
+	if (snapshot.Content["header"] == "") {
+		// the content has not been built
+		return error_html
+	}
+
+	return fill_page_head(snapshot.Content["header"], status + " - " + site_title(snapshot.Site), "") + error_html + snapshot.Content["footer"]
+
+}
+
+func fill_page_head(h string, page_title string, meta string) (string) {
+	// replace the unique strings that represent the positions of the page title and meta tags in main/index.html
+
+	h = strings.Replace(h, "<!-- ######page_title###### -->", html.EscapeString(page_title), 1)
+	h = strings.Replace(h, "<!-- ######meta###### -->", meta, 1)
+
+	return h
+
+}
+
+func page_meta(s *Site, page_title string, description string, canonical_path string, og_type string, published time.Time) (string) {
+	// return the meta description, canonical url, Open Graph and Twitter tags of a page
+
+	var canonical = html.EscapeString(site_url(s) + canonical_path)
+	page_title = html.EscapeString(page_title)
+	description = html.EscapeString(description)
 
-		if (end_of_header == false) {
+	var m = ""
 
-			// add to header_data
-			for b := 0; b < l; b++ {
-				header_data = append(header_data, buf[b])
-			}
+	if (description != "") {
+		m += "<meta name=\"description\" content=\"" + description + "\">\n"
+	}
 
-			// find the end of the headers
-			var header_end_index = bytes.Index(header_data, []byte("\r\n\r\n"))
+	m += "<link rel=\"canonical\" href=\"" + canonical + "\">\n"
+	m += "<link rel=\"alternate\" type=\"application/rss+xml\" title=\"" + html.EscapeString(site_title(s)) + "\" href=\"/feed.xml\">\n"
 
-			if (header_end_index > -1) {
+	m += "<meta property=\"og:type\" content=\"" + og_type + "\">\n"
+	m += "<meta property=\"og:site_name\" content=\"" + html.EscapeString(site_title(s)) + "\">\n"
+	m += "<meta property=\"og:title\" content=\"" + page_title + "\">\n"
+	m += "<meta property=\"og:url\" content=\"" + canonical + "\">\n"
 
-				// end of header is in header_data
-				end_of_header = true
+	if (description != "") {
+		m += "<meta property=\"og:description\" content=\"" + description + "\">\n"
+	}
 
-				if (bytes.Index(header_data, []byte("GET ")) == 0) {
-					// no body data sent in a GET request
-					header_data = header_data[0:header_end_index]
-					// no more data allowed
-					break
-				} else if (header_end_index + 4 < len(header_data)) {
+	if (published.IsZero() == false) {
+		m += "<meta property=\"article:published_time\" content=\"" + published.UTC().Format(time.RFC3339) + "\">\n"
+	}
 
-					// this is a request type other than GET
-					read_body_data = true
+	m += "<meta name=\"twitter:card\" content=\"summary\">\n"
+	m += "<meta name=\"twitter:title\" content=\"" + page_title + "\">\n"
 
-					// avoid waiting for the read deadline
-					// that could be caused by no content-length header being sent in the request
-					// if there is a content-length header
-					var content_length_header_start = bytes.Index(bytes.ToLower(header_data), []byte("content-length:"))
+	if (description != "") {
+		m += "<meta name=\"twitter:description\" content=\"" + description + "\">\n"
+	}
 
-					if (content_length_header_start > -1) {
+	return m
 
-						var content_length_header_end = bytes.Index(header_data[content_length_header_start:], []byte("\r\n"))
+}
 
-						if (content_length_header_end > -1) {
+func escape_path(p string) (string) {
+	// return a url path with each segment escaped, /categories/a b is /categories/a%20b
 
-							var content_length_header = header_data[content_length_header_start:content_length_header_start + content_length_header_end]
+	var u = url.URL{Path: p}
+	return u.EscapedPath()
 
-							content_length, _ = strconv.Atoi(string(content_length_header[len("content-length: "):len(content_length_header)]))
+}
 
-						}
-					}
+func category_path(cat string) (string) {
+	// return the escaped url path of a category, a / in the name is escaped
 
-					// there is body data in header_data
-					//fmt.Println("body data in header_data")
+	return "/categories/" + url.PathEscape(cat)
 
-					body_data = header_data[header_end_index + 4:]
-					header_data = header_data[0:header_end_index]
+}
 
-				}
+func get_post_title(s *SiteSnapshot, post_path string) (string) {
 
-			}
+	return s.Titles[post_path]
 
-		}
+}
 
-	}
+func get_post_ts(s *SiteSnapshot, post_path string) (int64) {
 
-	// get request URL
-	var first_line_end = bytes.Index(header_data, []byte("\r\n"))
+	var date = s.PostsByDate[post_path]
+	return date.Unix()
 
-	if (first_line_end == -1) {
-		// invalid request
-		conn.Close()
-		return
-	}
+}
 
-	var first_line_space_split = bytes.Split(header_data[:first_line_end], []byte(" "))
+func site_url(s *Site) (string) {
+	// return the https url of the site without a trailing /
 
-	var request_path string
-	if (len(first_line_space_split) < 3) {
-		// invalid request
-		// should be similar to GET / HTTP/1.1
-		conn.Close()
-		return
-	} else {
-		// the second item is the path
-		request_path = string(first_line_space_split[1])
+	var u = "https://" + s.Hostnames[0]
+
+	if (config.Port != 443) {
+		// add the not standard HTTPS port
+		u += ":" + strconv.FormatInt(config.Port, 10)
 	}
 
-	// parse the url
-	urlp, urlp_err := url.Parse(request_path)
+	return u
 
-	if (urlp_err != nil) {
-		conn.Write([]byte("HTTP/1.1 404\r\n"))
-		conn.Write([]byte("\r\n"))
-		conn.Write([]byte("not found"))
-		conn.Close()
-		return
-	}
+}
 
-	// process URL authentication before reading body data
+func site_title(s *Site) (string) {
 
-	if (read_body_data == true) {
+	if (s.Title == "") {
+		// use the hostname when there is no configured title
+		return s.Hostnames[0]
+	}
 
-		// read body data
-		tlen = 0
-		for true {
+	return s.Title
 
-			if (content_length > -1) {
+}
 
-				if (len(body_data) >= content_length) {
-					// do not wait for the read deadline
-					// all the data has been sent
-					body_data = body_data[:content_length]
-					break
-				}
+func xml_escape(s string) (string) {
 
-			}
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
 
-			// set the read timeout for each read
-			conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+}
 
-			buf := make([]byte, 1500)
-			l, err := conn.Read(buf)
+func get_post_categories(post_path string, from map[string] []string) ([]string) {
+	// return the categories of a post sorted by character
 
-			if (err != nil) {
-				// error reading request data
-				//fmt.Println("http/s server read error:", err)
+	var cats []string
+	for c := range from {
+		for l := range from[c] {
+			if (from[c][l] == post_path) {
+				cats = append(cats, c)
 				break
 			}
+		}
+	}
 
-			tlen += l
+	sort.Strings(cats)
 
-			if (tlen > 2000) {
-				// body is too long
-				conn.Write([]byte("HTTP/1.1 400 body too long\r\n\r\n"))
-				conn.Close()
-				return
-			}
+	return cats
 
-			// add to body_data
-			for b := 0; b < l; b++ {
-				body_data = append(body_data, buf[b])
-			}
+}
 
-		}
+func feed_count(s *Site) (int) {
+	// return the number of posts in each feed
 
+	if (s.FeedPostsCount <= 0) {
+		return s.RecentPostsCount
 	}
 
-	var response_headers []byte
+	return s.FeedPostsCount
 
-	sending_content = sending_content + 1
+}
 
-	// add random length header to prevent length based resource guessing, there may be random length TLS padding, this fixes it regardless
-	// requests should be sent in a random order also
-	var rand_len = mrand.Intn(20)
-	var rl = ""
-	for r := 0; r<rand_len; r++ {
-		rl += "a"
-	}
-	response_headers = bytes.Join([][]byte{response_headers, []byte("RL: " + rl + "\r\n")}, nil)
+func feed_content_type(path string) (string) {
+	// return the Content-Type of a feed url or an empty string if it is not a feed url
 
-	if (urlp.Path == "/" || urlp.Path == "") {
+	if (strings.HasSuffix(path, "/feed.xml") == true) {
+		return "application/rss+xml; charset=utf-8"
+	} else if (strings.HasSuffix(path, "/atom.xml") == true) {
+		return "application/atom+xml; charset=utf-8"
+	} else if (strings.HasSuffix(path, "/feed.json") == true) {
+		return "application/feed+json; charset=utf-8"
+	}
 
-		var q = urlp.Query()
+	return ""
 
-		var p = q.Get("page")
+}
 
-		if (p == "") {
-			// first page is default
-			p = "0"
-		}
-		//fmt.Println("page", p)
+func add_feeds(ns *SiteSnapshot, url_prefix string, title string, home_path string, post_paths []string) {
+	// add the RSS, Atom and JSON feeds of post_paths to the snapshot that is being built
+	// url_prefix is the path the feed files are served from and ends with /
+	// post_paths must be ordered by date with the most recent first
 
-		// main view, paginated
-		response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: text/html\r\n")}, nil)
-		response_headers = bytes.Join([][]byte{response_headers, []byte("Cache-Control: max-age=0\r\n")}, nil)
-		conn.Write([]byte("HTTP/1.1 200\r\n"))
-		conn.Write(response_headers)
-		conn.Write([]byte("\r\n"))
-		conn.Write([]byte(content["url_part_0:/"]))
-		conn.Write([]byte(content["page:" + p]))
-		conn.Write([]byte(content["url_part_1:/"]))
+	if (len(post_paths) > feed_count(ns.Site)) {
+		post_paths = post_paths[:feed_count(ns.Site)]
+	}
 
-	} else if (strings.Index(urlp.Path, "/categories/") == 0) {
+	// the feed urls in the feeds are escaped
+	var link_prefix = escape_path(url_prefix)
 
-		// get category
-		var cat = strings.TrimPrefix(urlp.Path, "/categories/")
+	ns.Content["url:" + url_prefix + "feed.xml"] = rss_feed(ns, link_prefix + "feed.xml", title, home_path, post_paths)
+	ns.Content["url:" + url_prefix + "atom.xml"] = atom_feed(ns, link_prefix + "atom.xml", title, home_path, post_paths)
+	ns.Content["url:" + url_prefix + "feed.json"] = json_feed(ns, link_prefix + "feed.json", title, home_path, post_paths)
 
-		if (len(categories[cat]) > 0) {
-			// exists
-			response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: text/html\r\n")}, nil)
-			response_headers = bytes.Join([][]byte{response_headers, []byte("Cache-Control: max-age=0\r\n")}, nil)
-			conn.Write([]byte("HTTP/1.1 200\r\n"))
-			conn.Write(response_headers)
-			conn.Write([]byte("\r\n"))
-			conn.Write([]byte(content["header"]))
+}
 
-			var s = "<span class=\"category_title\">" + cat + "</span>"
-			for c := range categories[cat] {
-				var post_path = categories[cat][c]
+func rss_feed(ns *SiteSnapshot, feed_path string, title string, home_path string, post_paths []string) (string) {
+	// create the RSS 2.0 feed from the snapshot that is being built
 
-				var title = get_post_title(post_path)
-				var ts = strconv.FormatInt(get_post_ts(post_path, false), 10)
+	var feed = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"
+	feed += "<rss version=\"2.0\" xmlns:atom=\"http://www.w3.org/2005/Atom\">\n"
+	feed += "<channel>\n"
+	feed += "<title>" + xml_escape(title) + "</title>\n"
+	feed += "<link>" + xml_escape(site_url(ns.Site) + home_path) + "</link>\n"
+	feed += "<description>" + xml_escape(ns.Site.Description) + "</description>\n"
+	feed += "<atom:link href=\"" + xml_escape(site_url(ns.Site) + feed_path) + "\" rel=\"self\" type=\"application/rss+xml\"/>\n"
 
-				s += "<div class=\"category_post_entry\"><a href=\"/" + post_path + "\" class=\"category_post_link\">" + title + "</a><span class=\"unix_ts category_post_date\">" + ts + "</span></div>"
-			}
+	if (len(post_paths) > 0) {
+		// the most recent post is the last build date
+		feed += "<lastBuildDate>" + ns.PostsByDate[post_paths[0]].UTC().Format(time.RFC1123Z) + "</lastBuildDate>\n"
+	}
 
-			conn.Write([]byte(s))
-			conn.Write([]byte(content["footer"]))
+	for p := range post_paths {
 
-		} else {
-			// does not exist
-			conn.Write([]byte("HTTP/1.1 404\r\n"))
-			conn.Write(response_headers)
-			conn.Write([]byte("\r\n"))
-			conn.Write([]byte("not found"))
-		}
+		var post_path = post_paths[p]
+		var link = site_url(ns.Site) + escape_path("/" + post_path)
 
-	} else if (strings.Index(urlp.Path, "/posts/") == 0) {
+		feed += "<item>\n"
+		feed += "<title>" + xml_escape(ns.Titles[post_path]) + "</title>\n"
+		feed += "<link>" + xml_escape(link) + "</link>\n"
+		feed += "<guid isPermaLink=\"true\">" + xml_escape(link) + "</guid>\n"
+		feed += "<pubDate>" + ns.PostsByDate[post_path].UTC().Format(time.RFC1123Z) + "</pubDate>\n"
 
-		// a post
-		if (content["url:" + urlp.Path] == "") {
-			// does not exist
-			response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: text/html\r\n")}, nil)
-			conn.Write([]byte("HTTP/1.1 404\r\n"))
-			conn.Write(response_headers)
-			conn.Write([]byte("\r\n"))
-			conn.Write([]byte("not found"))
-		} else {
-			// exists
-			response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: text/html\r\n")}, nil)
-			response_headers = bytes.Join([][]byte{response_headers, []byte("Cache-Control: max-age=0\r\n")}, nil)
-			conn.Write([]byte("HTTP/1.1 200\r\n"))
-			conn.Write(response_headers)
-			conn.Write([]byte("\r\n"))
-			conn.Write([]byte(content["header"] + content["url:" + urlp.Path] + content["footer"]))
+		var cats = get_post_categories(post_path, ns.Categories)
+		for c := range cats {
+			feed += "<category>" + xml_escape(cats[c]) + "</category>\n"
 		}
 
-	} else if (strings.Index(urlp.Path, "/..") != -1) {
-
-		// invalid URL, someone is trying to access a file they should not be trying to access
-		conn.Write([]byte("HTTP/1.1 401\r\n"))
-		conn.Write(response_headers)
-		conn.Write([]byte("\r\n"))
-
-	} else {
+		feed += "<description>" + xml_escape(ns.PostDescriptions[post_path]) + "</description>\n"
+		feed += "</item>\n"
 
-		fi, fi_err := os.Lstat("main" + urlp.Path)
+	}
 
-		var redirect = false
+	feed += "</channel>\n"
+	feed += "</rss>\n"
 
-		if (fi_err != nil) {
+	return feed
 
-			// file or directory not found
-			response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: text/html\r\n")}, nil)
-			conn.Write([]byte("HTTP/1.1 404\r\n"))
-			conn.Write(response_headers)
-			conn.Write([]byte("\r\n"))
-			conn.Write([]byte("not found"))
+}
 
-		} else {
+func atom_feed(ns *SiteSnapshot, feed_path string, title string, home_path string, post_paths []string) (string) {
+	// create the Atom 1.0 feed from the snapshot that is being built
 
-			var continue_after_link = true
+	var feed = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"
+	feed += "<feed xmlns=\"http://www.w3.org/2005/Atom\">\n"
+	feed += "<title>" + xml_escape(title) + "</title>\n"
+	if (ns.Site.Description != "") {
+		feed += "<subtitle>" + xml_escape(ns.Site.Description) + "</subtitle>\n"
+	}
+	feed += "<id>" + xml_escape(site_url(ns.Site) + feed_path) + "</id>\n"
+	feed += "<link rel=\"self\" type=\"application/atom+xml\" href=\"" + xml_escape(site_url(ns.Site) + feed_path) + "\"/>\n"
+	feed += "<link rel=\"alternate\" type=\"text/html\" href=\"" + xml_escape(site_url(ns.Site) + home_path) + "\"/>\n"
+	feed += "<author><name>" + xml_escape(site_title(ns.Site)) + "</name></author>\n"
+
+	if (len(post_paths) > 0) {
+		// the most recent post is the feed update time
+		feed += "<updated>" + ns.PostsByDate[post_paths[0]].UTC().Format(time.RFC3339) + "</updated>\n"
+	} else {
+		feed += "<updated>" + time.Unix(0, 0).UTC().Format(time.RFC3339) + "</updated>\n"
+	}
 
-			if (fi.Mode()&os.ModeSymlink != 0) {
+	for p := range post_paths {
 
-				// this is a link, find the target
-				continue_after_link = false
-				rpath, rl_err := os.Readlink("main" + urlp.Path)
-				if (rl_err != nil) {
+		var post_path = post_paths[p]
+		var link = site_url(ns.Site) + escape_path("/" + post_path)
+		var published = ns.PostsByDate[post_path].UTC().Format(time.RFC3339)
 
-					// link has no target
-					response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: text/html\r\n")}, nil)
-					conn.Write([]byte("HTTP/1.1 404\r\n"))
-					conn.Write(response_headers)
-					conn.Write([]byte("\r\n"))
-					conn.Write([]byte("not found"))
+		feed += "<entry>\n"
+		feed += "<title>" + xml_escape(ns.Titles[post_path]) + "</title>\n"
+		feed += "<id>" + xml_escape(link) + "</id>\n"
+		feed += "<link rel=\"alternate\" type=\"text/html\" href=\"" + xml_escape(link) + "\"/>\n"
+		feed += "<published>" + published + "</published>\n"
+		feed += "<updated>" + published + "</updated>\n"
 
-				} else {
+		var cats = get_post_categories(post_path, ns.Categories)
+		for c := range cats {
+			feed += "<category term=\"" + xml_escape(cats[c]) + "\"/>\n"
+		}
 
-					// the target is real, solve if it is a directory or a file
-					// set fi to the real path
-					// links to links fail after the first link
+		feed += "<summary type=\"html\">" + xml_escape(ns.PostDescriptions[post_path]) + "</summary>\n"
+		feed += "</entry>\n"
 
-					fi, fi_err = os.Lstat(rpath)
+	}
 
-					if (fi_err != nil) {
+	feed += "</feed>\n"
 
-						// linked file or directory not found
-						response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: text/html\r\n")}, nil)
-						conn.Write([]byte("HTTP/1.1 404\r\n"))
-						conn.Write(response_headers)
-						conn.Write([]byte("\r\n"))
-						conn.Write([]byte("not found"))
+	return feed
 
-					} else {
+}
 
-						if (fi.Mode()&os.ModeSymlink != 0) {
+func sitemap(ns *SiteSnapshot, post_paths []string, pages int) (string) {
+	// create the sitemap from the snapshot that is being built
+	// post_paths must be ordered by date with the most recent first
 
-							// link to a link
-							response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: text/html\r\n")}, nil)
-							conn.Write([]byte("HTTP/1.1 404\r\n"))
-							conn.Write(response_headers)
-							conn.Write([]byte("\r\n"))
-							conn.Write([]byte("link to link error"))
+	var sm = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"
+	sm += "<urlset xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">\n"
 
-						} else {
+	var newest time.Time
+	if (len(post_paths) > 0) {
+		newest = get_post_lastmod(ns, post_paths[0])
+	}
 
-							// link file or directory found
-							continue_after_link = true
+	// / and each page after the first page, the canonical url of the first page is /
+	sm += sitemap_url(ns.Site, "/", newest)
+	for p := 1; p < pages; p++ {
+		sm += sitemap_url(ns.Site, "/?page=" + strconv.Itoa(p), newest)
+	}
 
-						}
+	// each category, ordered by character
+	srr := make([]string, 0)
+	for c := range ns.Categories {
+		srr = append(srr, c)
+	}
 
-					}
+	sort.Strings(srr)
 
-				}
+	for k := range srr {
 
+		// the lastmod of a category is the lastmod of the newest post in it
+		var cat_lastmod time.Time
+		for l := range ns.Categories[srr[k]] {
+			var lm = get_post_lastmod(ns, ns.Categories[srr[k]][l])
+			if (lm.After(cat_lastmod) == true) {
+				cat_lastmod = lm
 			}
+		}
 
-			if (fi_err == nil && fi.IsDir() == true && continue_after_link == true) {
+		sm += sitemap_url(ns.Site, category_path(srr[k]), cat_lastmod)
 
-				// this is not a file, add index.html to the path
-				if (urlp.Path[len(urlp.Path)-1] == 47) {
-					urlp.Path += "index.html"
-				} else {
-					// must redirect to /
-					urlp.Path += "/"
-					redirect = true
-				}
+	}
 
-			}
+	// each post, including posts without a date: header
+	psr := make([]string, 0)
+	for p := range ns.PostDescriptions {
+		psr = append(psr, p)
+	}
 
-		}
+	sort.Strings(psr)
 
-		if (redirect == true) {
+	for p := range psr {
+		sm += sitemap_url(ns.Site, escape_path("/" + psr[p]), get_post_lastmod(ns, psr[p]))
+	}
 
-			// redirect to add / to end of path
-			// domain.tld/path was typed and must be domain.tld/path/
-			response_headers = bytes.Join([][]byte{response_headers, []byte("Location: " + urlp.Path + "\r\n")}, nil)
-			conn.Write([]byte("HTTP/1.1 302 Found\r\n"))
-			conn.Write(response_headers)
-			conn.Write([]byte("\r\n"))
+	sm += "</urlset>\n"
 
-		} else if (fi_err == nil) {
-			// file or directory was found
-			// but it may be missing (this is the fastest way)
-			// because it could be index.html
+	return sm
 
-			// try to open file accessed by the browser, included in the /main directory
-			f, err := os.Open("main" + urlp.Path)
+}
 
-			if (err != nil) {
+func sitemap_url(s *Site, path string, lastmod time.Time) (string) {
 
-				// file not found
-				//w.WriteHeader(http.StatusNotFound)
-				response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: text/html\r\n")}, nil)
-				conn.Write([]byte("HTTP/1.1 404\r\n"))
-				conn.Write(response_headers)
-				conn.Write([]byte("\r\n"))
-				conn.Write([]byte("not found"))
+	var u = "<url><loc>" + xml_escape(site_url(s) + path) + "</loc>"
 
-			} else {
+	if (lastmod.IsZero() == false) {
+		u += "<lastmod>" + lastmod.UTC().Format(time.RFC3339) + "</lastmod>"
+	}
 
-				// add cache headers for files, 1 hour
-				response_headers = bytes.Join([][]byte{response_headers, []byte("Cache-Control: max-age=3600\r\n")}, nil)
-				conn.Write([]byte("HTTP/1.1 200\r\n"))
+	return u + "</url>\n"
 
-				// get extension
-				var ext_p = strings.Split(urlp.Path, ".")
-				var ext = ""
-				if (len(ext_p) >= 2) {
-					ext = ext_p[len(ext_p) - 1]
-					response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: " + mime_types[ext] + "\r\n")}, nil)
-				}
+}
 
-				if (ext == "") {
-					response_headers = bytes.Join([][]byte{response_headers, []byte("Content-Type: application/octet-stream\r\n")}, nil)
-				}
+func get_post_lastmod(ns *SiteSnapshot, post_path string) (time.Time) {
+	// the date: header or the file modification time if there is no date: header
 
-				conn.Write(response_headers)
-				conn.Write([]byte("\r\n"))
+	if (ns.PostsByDate[post_path].IsZero() == false) {
+		return ns.PostsByDate[post_path]
+	}
 
-				// send content
-				for (true) {
-					b := make([]byte, 1350)
-					n, read_err := f.Read(b)
-					if (read_err != nil) {
-						// sent whole file or there was an error
-						break
-					}
-					_ = n
-					conn.Write(b[:n])
+	return ns.PostMtimes[post_path]
 
-				}
+}
 
-				f.Close()
+func robots_txt(s *Site) (string) {
+	// create robots.txt with the configured disallow rules and the sitemap url
 
-			}
+	var r = "User-agent: *\n"
 
-		}
+	if (len(s.RobotsDisallow) == 0) {
+		// allow everything
+		r += "Disallow:\n"
+	}
 
+	for d := range s.RobotsDisallow {
+		r += "Disallow: " + s.RobotsDisallow[d] + "\n"
 	}
 
-	sending_content = sending_content - 1
+	r += "\nSitemap: " + site_url(s) + "/sitemap.xml\n"
 
-	conn.Close()
+	return r
 
 }
 
-func get_post_title(post_path string) (string) {
-
-	var title = ""
-	for l := range titles {
+func file_exists(path string) (bool) {
 
-		if (l == post_path) {
-			title = titles[l]
-			break
-		}
+	_, err := os.Stat(path)
+	return err == nil
 
-	}
+}
 
-	return title
+type JsonFeed struct {
+	Version				string		`json:"version"`
+	Title				string		`json:"title"`
+	HomePageUrl			string		`json:"home_page_url"`
+	FeedUrl				string		`json:"feed_url"`
+	Description			string		`json:"description,omitempty"`
+	Items				[]JsonFeedItem	`json:"items"`
+}
 
+type JsonFeedItem struct {
+	Id				string		`json:"id"`
+	Url				string		`json:"url"`
+	Title				string		`json:"title"`
+	ContentHtml			string		`json:"content_html"`
+	DatePublished			string		`json:"date_published"`
+	Tags				[]string	`json:"tags,omitempty"`
 }
 
-func get_post_ts(post_path string, use_new bool) (int64) {
+func json_feed(ns *SiteSnapshot, feed_path string, title string, home_path string, post_paths []string) (string) {
+	// create the JSON Feed 1.1 feed from the snapshot that is being built
+
+	var feed = JsonFeed{Version: "https://jsonfeed.org/version/1.1", Title: title, HomePageUrl: site_url(ns.Site) + home_path, FeedUrl: site_url(ns.Site) + feed_path, Description: ns.Site.Description}
+	feed.Items = make([]JsonFeedItem, 0)
+
+	for p := range post_paths {
+
+		var post_path = post_paths[p]
+		var link = site_url(ns.Site) + escape_path("/" + post_path)
+
+		feed.Items = append(feed.Items, JsonFeedItem{Id: link, Url: link, Title: ns.Titles[post_path], ContentHtml: ns.PostDescriptions[post_path], DatePublished: ns.PostsByDate[post_path].UTC().Format(time.RFC3339), Tags: get_post_categories(post_path, ns.Categories)})
 
-	var from = posts_by_date
-	if (use_new == true) {
-		// use new posts by date map
-		from = new_posts_by_date
 	}
 
-	var date time.Time
-	for l := range from {
-		if (l == post_path) {
-			date = from[l]
-			break
-		}
+	// the html is not escaped as \u003c, the feed is not embedded in html
+	var feed_json bytes.Buffer
+	var enc = json.NewEncoder(&feed_json)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+
+	err := enc.Encode(feed)
+	if (err != nil) {
+		fmt.Println("error creating JSON feed:", feed_path, err)
+		return ""
 	}
 
-	return date.Unix()
+	return feed_json.String()
 
 }
 
@@ -1112,6 +2928,7 @@ func timeago(t time.Time) (string) {
 }
 
 func CertFromPemBytes(bytes []byte, password string) (tls.Certificate, error) {
+	// the certificates and the private key, which may be encrypted with password, in PEM blocks
 	var cert tls.Certificate
 	var block *pem.Block
 	for {
@@ -1122,15 +2939,223 @@ func CertFromPemBytes(bytes []byte, password string) (tls.Certificate, error) {
 
 		if block.Type == "CERTIFICATE" {
 			cert.Certificate = append(cert.Certificate, block.Bytes)
+		} else if (strings.HasSuffix(block.Type, "PRIVATE KEY") == true && cert.PrivateKey == nil) {
+			key, err := parse_private_key(block, password)
+			if (err != nil) {
+				return tls.Certificate{}, err
+			}
+			cert.PrivateKey = key
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		return tls.Certificate{}, errors.New("no certificate")
+	}
+	if c, e := x509.ParseCertificate(cert.Certificate[0]); e == nil {
+		cert.Leaf = c
+	}
+	if (cert.PrivateKey != nil && cert.Leaf != nil) {
+		// the key must be the key of the first certificate
+		pub, ok := cert.Leaf.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+		signer, signer_ok := cert.PrivateKey.(crypto.Signer)
+		if (ok == false || signer_ok == false || pub.Equal(signer.Public()) == false) {
+			return tls.Certificate{}, errors.New("private key does not match the certificate")
+		}
+	}
+	return cert, nil
+}
+
+func parse_private_key(block *pem.Block, password string) (crypto.PrivateKey, error) {
+	// parse an unencrypted, PKCS#8 encrypted (ENCRYPTED PRIVATE KEY) or legacy encrypted (Proc-Type: 4,ENCRYPTED) PEM private key
+
+	var der = block.Bytes
+	var encrypted = false
+
+	if (block.Type == "ENCRYPTED PRIVATE KEY") {
+
+		if (password == "") {
+			return nil, errors.New("the private key is encrypted and there is no sslPassphrase")
+		}
+
+		d, err := decrypt_pkcs8(der, password)
+		if (err != nil) {
+			return nil, err
+		}
+		der = d
+		encrypted = true
+
+	} else if (x509.IsEncryptedPEMBlock(block) == true) {
+
+		if (password == "") {
+			return nil, errors.New("the private key is encrypted and there is no sslPassphrase")
+		}
+
+		// legacy encryption from openssl genrsa -aes256 or openssl rsa -aes256 -traditional
+		d, err := x509.DecryptPEMBlock(block, []byte(password))
+		if (err != nil) {
+			return nil, errors.New("the private key could not be decrypted, the sslPassphrase may be wrong")
 		}
+		der = d
+		encrypted = true
+
+	}
+
+	rsa_key, rsa_err := x509.ParsePKCS1PrivateKey(der)
+	if (rsa_err == nil) {
+		return rsa_key, nil
+	}
+
+	pkcs8_key, pkcs8_err := x509.ParsePKCS8PrivateKey(der)
+	if (pkcs8_err == nil) {
+		return pkcs8_key, nil
+	}
+
+	ec_key, ec_err := x509.ParseECPrivateKey(der)
+	if (ec_err == nil) {
+		return ec_key, nil
+	}
+
+	if (encrypted == true) {
+		// a wrong passphrase can decrypt to data with valid padding
+		return nil, errors.New("the private key could not be decrypted, the sslPassphrase may be wrong")
+	}
+
+	return nil, errors.New("the private key could not be parsed")
+
+}
+
+var oid_pbes2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+var oid_pbkdf2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+type pkcs8_encrypted struct {
+	Algorithm			pkix.AlgorithmIdentifier
+	EncryptedData			[]byte
+}
+
+type pbes2_params struct {
+	KeyDerivationFunc		pkix.AlgorithmIdentifier
+	EncryptionScheme		pkix.AlgorithmIdentifier
+}
+
+type pbkdf2_params struct {
+	Salt				[]byte
+	IterationCount			int
+	KeyLength			int	`asn1:"optional"`
+	Prf				pkix.AlgorithmIdentifier	`asn1:"optional"`
+}
+
+func decrypt_pkcs8(der []byte, password string) ([]byte, error) {
+	// decrypt a PKCS#8 EncryptedPrivateKeyInfo with PBES2, PBKDF2 and AES-CBC or 3DES-CBC, the format of openssl genpkey -aes256
+
+	var info pkcs8_encrypted
+	_, err := asn1.Unmarshal(der, &info)
+	if (err != nil) {
+		return nil, err
+	}
+
+	if (info.Algorithm.Algorithm.Equal(oid_pbes2) == false) {
+		return nil, errors.New("the private key encryption is not PBES2")
+	}
+
+	var params pbes2_params
+	_, err = asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params)
+	if (err != nil) {
+		return nil, err
+	}
+
+	if (params.KeyDerivationFunc.Algorithm.Equal(oid_pbkdf2) == false) {
+		return nil, errors.New("the private key key derivation function is not PBKDF2")
+	}
+
+	var kdf pbkdf2_params
+	_, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf)
+	if (err != nil) {
+		return nil, err
+	}
+
+	// the pseudo random function of PBKDF2 is HMAC-SHA1 when it is not in the parameters
+	var prf func() hash.Hash = sha1.New
+	var prf_oid = kdf.Prf.Algorithm.String()
+	if (prf_oid == "1.2.840.113549.2.9") {
+		prf = sha256.New
+	} else if (prf_oid == "1.2.840.113549.2.10") {
+		prf = sha512.New384
+	} else if (prf_oid == "1.2.840.113549.2.11") {
+		prf = sha512.New
+	} else if (len(kdf.Prf.Algorithm) > 0 && prf_oid != "1.2.840.113549.2.7") {
+		return nil, errors.New("the private key PBKDF2 function is not supported: " + prf_oid)
+	}
+
+	// AES-128-CBC, AES-192-CBC, AES-256-CBC or DES-EDE3-CBC
+	var key_length = 0
+	var new_cipher func([]byte) (cipher.Block, error)
+	var cipher_oid = params.EncryptionScheme.Algorithm.String()
+	if (cipher_oid == "2.16.840.1.101.3.4.1.2") {
+		key_length = 16
+		new_cipher = aes.NewCipher
+	} else if (cipher_oid == "2.16.840.1.101.3.4.1.22") {
+		key_length = 24
+		new_cipher = aes.NewCipher
+	} else if (cipher_oid == "2.16.840.1.101.3.4.1.42") {
+		key_length = 32
+		new_cipher = aes.NewCipher
+	} else if (cipher_oid == "1.2.840.113549.3.7") {
+		key_length = 24
+		new_cipher = des.NewTripleDESCipher
+	} else {
+		return nil, errors.New("the private key cipher is not supported: " + cipher_oid)
+	}
+
+	var iv []byte
+	_, err = asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv)
+	if (err != nil) {
+		return nil, err
+	}
+
+	key, err := pbkdf2.Key(prf, password, kdf.Salt, kdf.IterationCount, key_length)
+	if (err != nil) {
+		return nil, err
+	}
+
+	block, err := new_cipher(key)
+	if (err != nil) {
+		return nil, err
+	}
+
+	if (len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData) % block.BlockSize() != 0) {
+		return nil, errors.New("the private key could not be decrypted")
+	}
+
+	var plain = make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+
+	// remove the PKCS#7 padding, a wrong password makes invalid padding
+	var padding = int(plain[len(plain) - 1])
+	if (padding == 0 || padding > block.BlockSize() || bytes.Equal(plain[len(plain) - padding:], bytes.Repeat([]byte{byte(padding)}, padding)) == false) {
+		return nil, errors.New("the private key could not be decrypted, the sslPassphrase may be wrong")
 	}
-	if len(cert.Certificate) == 0 {
-		return tls.Certificate{}, errors.New("no certificate")
+
+	return plain[:len(plain) - padding], nil
+
+}
+
+func get_ssl_passphrase(s *Site) (string) {
+	// return the passphrase of the private key of the site from the environment variable, the file or config.json
+
+	if (s.SslPassphraseEnv != "" && os.Getenv(s.SslPassphraseEnv) != "") {
+		return os.Getenv(s.SslPassphraseEnv)
 	}
-	if c, e := x509.ParseCertificate(cert.Certificate[0]); e == nil {
-		cert.Leaf = c
+
+	if (s.SslPassphraseFile != "") {
+		b, err := os.ReadFile(s.SslPassphraseFile)
+		if (err != nil) {
+			fmt.Println("error reading sslPassphraseFile:", err)
+		} else {
+			return strings.TrimRight(string(b), "\r\n")
+		}
 	}
-	return cert, nil
+
+	return s.SslPassphrase
+
 }
 
 func main() {
@@ -1157,15 +3182,8 @@ func main() {
 		os.Exit(1)
 	}
 
-	new_categories = make(map[string] []string)
-	categories = make(map[string] []string)
-	new_posts_by_date = make(map[string] time.Time)
-	posts_by_date = make(map[string] time.Time)
-	new_titles = make(map[string] string)
-	titles = make(map[string] string)
-	short_posts = make(map[string] string)
-	new_content = make(map[string] string)
-	content = make(map[string] string)
+	// the sites, an empty snapshot is served for each site until content_loop builds the first snapshot
+	init_sites()
 
 	// basic mime types
 	mime_types = make(map[string] string)
@@ -1181,8 +3199,27 @@ func main() {
 	mime_types["svg"] = "image/svg+xml"
 	mime_types["js"] = "text/javascript"
 	mime_types["css"] = "text/css"
+	mime_types["ico"] = "image/x-icon"
+	mime_types["pdf"] = "application/pdf"
+	mime_types["woff"] = "font/woff"
+	mime_types["woff2"] = "font/woff2"
+	mime_types["mp4"] = "video/mp4"
+	mime_types["webm"] = "video/webm"
+	mime_types["mp3"] = "audio/mpeg"
+	mime_types["wasm"] = "application/wasm"
+	mime_types["webmanifest"] = "application/manifest+json"
+
+	// other types are found in the mime database of the system (/etc/mime.types) and Go
+
+	// mime types from config.json replace the basic mime types
+	for ext := range config.MimeTypes {
+		mime_types[strings.ToLower(strings.TrimPrefix(ext, "."))] = config.MimeTypes[ext]
+	}
 
-	go content_loop()
+	go watch_content_files()
+	for i := range config.Sites {
+		go content_loop(config.Sites[i])
+	}
 	go connection_count_loop()
 
 	// set the module directory for ipac
@@ -1192,33 +3229,48 @@ func main() {
 	// go-ip-ac
 	ipac.Init(&ip_ac)
 
-	var cert tls.Certificate
-	var tls_err error
-	var rootca []byte
-	if (config.LoadCertificatesFromFiles == true) {
-		cert, tls_err = tls.LoadX509KeyPair(config.SslCert, config.SslKey)
-		rootca, _ = os.ReadFile(config.SslCa)
+	tls_config := tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, MinVersion: tls.VersionTLS12, ServerName: config.Fqdn}
+	tls_config.Rand = rand.Reader
+
+	// HTTP/2 is negotiated with ALPN
+	tls_config.NextProtos = []string{"h2", "http/1.1"}
+
+	if (config.Acme.Enabled == true) {
+
+		// certificates are obtained and renewed with ACME
+		acme_manager = new_acme_manager()
+		tls_config.GetCertificate = acme_get_certificate
+
+		// TLS-ALPN-01 challenges are answered in the TLS handshake
+		tls_config.NextProtos = append(tls_config.NextProtos, acme.ALPNProto)
+
+		go acme_obtain_certificates()
+
 	} else {
-		cert, tls_err = tls.X509KeyPair([]byte(config.SslCert), []byte(config.SslKey))
-		rootca = []byte(config.SslCa)
-	}
 
-	if tls_err != nil {
-		fmt.Printf("HTTPS server did not load TLS certificates: %s\n", tls_err)
-		os.Exit(1)
-	}
+		for i := range config.Sites {
+			cert, tls_err := load_certificate(config.Sites[i])
+			if tls_err != nil {
+				fmt.Printf("HTTPS server did not load TLS certificates of %s: %s\n", config.Sites[i].Hostnames[0], tls_err)
+				os.Exit(1)
+			}
+			config.Sites[i].Certificate.Store(cert)
+			log_certificate_expiry(cert)
+		}
 
-	rootcert, rootcert_err := CertFromPemBytes(rootca, "")
-	if (rootcert_err == nil) {
-		// add the CA to the certificate chain (as NodeJS does by default)
-		for l := range(rootcert.Certificate) {
-			cert.Certificate = append(cert.Certificate, rootcert.Certificate[l])
+		// the certificates are loaded again when the files change or on SIGHUP
+		go certificate_loop()
+
+		// each handshake uses the most recently loaded certificate of the site of the server name
+		tls_config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			var s = site_for_host(hello.ServerName)
+			if (s == nil) {
+				return nil, errors.New("no site for server name " + hello.ServerName)
+			}
+			return s.Certificate.Load(), nil
 		}
-		cert.Leaf = rootcert.Leaf
-	}
 
-	tls_config := tls.Config{Certificates: []tls.Certificate{cert}, ClientAuth: tls.VerifyClientCertIfGiven, MinVersion: tls.VersionTLS12, ServerName: config.Fqdn}
-	tls_config.Rand = rand.Reader
+	}
 
 	// listen on tcp socket
 	ln, err := tls.Listen("tcp", ":" + strconv.FormatInt(config.Port, 10), &tls_config)
@@ -1228,6 +3280,11 @@ func main() {
 	}
 	defer ln.Close()
 
+	// HTTP/2 server, connections are sent to it after the TLS handshake
+	var h2_listener = ConnListener{Conns: make(chan net.Conn), ListenAddr: ln.Addr()}
+	var h2_server = http.Server{Handler: http.HandlerFunc(handle_h2_request), IdleTimeout: get_idle_timeout(), ErrorLog: log.New(io.Discard, "", 0)}
+	go h2_server.Serve(h2_listener)
+
 	// HTTPS server
 	// start a subroutine
 	go func() {
@@ -1244,7 +3301,6 @@ func main() {
 					// handle error
 					return
 				}
-				defer conn.Close()
 
 				// take the port number off the address
 				var ip, port, iperr = net.SplitHostPort(conn.RemoteAddr().String())
@@ -1256,9 +3312,28 @@ func main() {
 					return
 				}
 
-				// set the idle timeout
-				conn.SetDeadline(time.Now().Add(time.Second * 5))
+				// complete the TLS handshake to get the protocol negotiated with ALPN
+				var tls_conn = conn.(*tls.Conn)
+				tls_conn.SetDeadline(time.Now().Add(get_idle_timeout()))
+				if (tls_conn.Handshake() != nil) {
+					conn.Close()
+					return
+				}
+				tls_conn.SetDeadline(time.Time{})
+
+				if (tls_conn.ConnectionState().NegotiatedProtocol == acme.ALPNProto) {
+					// a TLS-ALPN-01 challenge is complete after the handshake
+					conn.Close()
+					return
+				}
+
+				if (tls_conn.ConnectionState().NegotiatedProtocol == "h2") {
+					// the HTTP/2 server closes the connection
+					h2_listener.Conns <- conn
+					return
+				}
 
+				// the idle timeout is set for each request and the connection is closed after the last request
 				handle_http_request(conn)
 
 			}()
@@ -1269,7 +3344,7 @@ func main() {
 
 	fmt.Println("HTTPS server started on port " + strconv.FormatInt(config.Port, 10))
 
-	if (config.RedirectFromDefaultHttpPort == true) {
+	if (config.RedirectFromDefaultHttpPort == true || config.Acme.Enabled == true) {
 
 		// HTTP server
 		ln, err := net.Listen("tcp", ":" + strconv.FormatInt(80, 10))
@@ -1310,7 +3385,7 @@ func main() {
 
 				// read the first line
 				buf := make([]byte, 400)
-				_, err = conn.Read(buf)
+				n, err := conn.Read(buf)
 
 				if (err != nil) {
 					// error reading request data
@@ -1319,21 +3394,61 @@ func main() {
 					continue
 				}
 
+				buf = buf[:n]
+
+				if (config.Acme.Enabled == true && bytes.Index(buf, []byte(" /.well-known/acme-challenge/")) != -1) {
+					// answer the HTTP-01 challenge
+					acme_http_challenge(conn, buf)
+					conn.Close()
+					continue
+				}
+
 				var request_path string = "/"
+				var host = ""
 
-				var lines = bytes.SplitN(buf, []byte("\r\n"), 2)
-				if (len(lines) == 2) {
+				var lines = bytes.Split(buf, []byte("\r\n"))
+				if (len(lines) >= 2) {
 
 					var parts = bytes.Split(lines[0], []byte(" "))
 
 					if (len(parts) < 3) {
-						// invalid request, redirect to config.Fqdn
+						// invalid request, redirect to the default site
 						// should be similar to GET / HTTP/1.1
 					} else {
 						// the second item is the path
 						request_path = string(parts[1])
 					}
 
+					// the Host header, the headers that did not fit in the buffer are not read
+					for l := 1; l < len(lines); l++ {
+						var colon = bytes.IndexByte(lines[l], ':')
+						if (colon != -1 && strings.ToLower(strings.TrimSpace(string(lines[l][:colon]))) == "host") {
+							host = strings.TrimSpace(string(lines[l][colon + 1:]))
+						}
+					}
+
+				}
+
+				// redirect to the hostname in the request when it is a hostname of a site or to the first hostname of the site
+				// aliases and unknown hostnames are redirected to the first hostname in one redirect
+				// the Host header is not sent in the Location header
+				var redirect_host = ""
+				host = normalize_host(host)
+				var hs = site_for_host(host)
+				if (hs != nil) {
+					redirect_host = hs.Hostnames[0]
+					for n := range hs.Hostnames {
+						if (hs.Hostnames[n] == host) {
+							redirect_host = host
+						}
+					}
+				}
+
+				if (redirect_host == "") {
+					// no site has the hostname and there is no default site
+					conn.Write([]byte("HTTP/1.1 421 Misdirected Request\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+					conn.Close()
+					continue
 				}
 
 				if (config.Port != 443) {
@@ -1341,7 +3456,7 @@ func main() {
 					request_path = ":" + strconv.FormatInt(config.Port, 10) + request_path
 				}
 
-				conn.Write([]byte("HTTP/1.1 301 Moved Permanently\r\nLocation: https://" + config.Fqdn + request_path + "\r\n\r\n"))
+				conn.Write([]byte("HTTP/1.1 301 Moved Permanently\r\nLocation: https://" + redirect_host + request_path + "\r\n\r\n"))
 				conn.Close()
 
 			}
@@ -1355,6 +3470,372 @@ func main() {
 }
 
 var sigs chan os.Signal
+
+// send to certificate_reload to load the certificate of each site again
+var certificate_reload = make(chan bool, 1)
+
+func load_certificate(s *Site) (*tls.Certificate, error) {
+	// load the certificate, private key and CA of the site from the files or config.json
+
+	var cert tls.Certificate
+	var tls_err error
+	var rootca []byte
+	var cert_pem []byte
+	var key_pem []byte
+	if (config.LoadCertificatesFromFiles == true) {
+		cert_pem, tls_err = os.ReadFile(s.SslCert)
+		if (tls_err == nil) {
+			key_pem, tls_err = os.ReadFile(s.SslKey)
+		}
+		rootca, _ = os.ReadFile(s.SslCa)
+	} else {
+		cert_pem = []byte(s.SslCert)
+		key_pem = []byte(s.SslKey)
+		rootca = []byte(s.SslCa)
+	}
+
+	if (tls_err == nil) {
+		// the private key may be encrypted with the passphrase
+		cert, tls_err = CertFromPemBytes(bytes.Join([][]byte{cert_pem, key_pem}, []byte("\n")), get_ssl_passphrase(s))
+	}
+
+	if (tls_err == nil && cert.PrivateKey == nil) {
+		tls_err = errors.New("no private key")
+	}
+
+	if tls_err != nil {
+		return nil, tls_err
+	}
+
+	rootcert, rootcert_err := CertFromPemBytes(rootca, "")
+	if (rootcert_err == nil) {
+		// add the CA to the certificate chain (as NodeJS does by default)
+		// the Leaf remains the server certificate
+		for l := range(rootcert.Certificate) {
+			cert.Certificate = append(cert.Certificate, rootcert.Certificate[l])
+		}
+	}
+
+	return &cert, nil
+
+}
+
+var acme_manager *autocert.Manager
+var acme_http_handler http.Handler
+
+func acme_names() ([]string) {
+	// the hostnames and aliases of each site and the names in acme.names
+
+	var names []string
+	for i := range config.Sites {
+		names = append(names, config.Sites[i].Hostnames...)
+		names = append(names, config.Sites[i].Aliases...)
+	}
+
+	return append(names, config.Acme.Names...)
+
+}
+
+func new_acme_manager() (*autocert.Manager) {
+	// create the ACME client for the hostnames of each site and the names in acme.names
+
+	var names = acme_names()
+
+	var cache_directory = config.Acme.CacheDirectory
+	if (cache_directory == "") {
+		cache_directory = "acme_cache"
+	}
+
+	var directory_url = config.Acme.DirectoryUrl
+	if (directory_url == "") {
+		directory_url = acme.LetsEncryptURL
+	}
+
+	var transport = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	var client = &acme.Client{DirectoryURL: directory_url, HTTPClient: &http.Client{Transport: &AcmeOrderTransport{Transport: transport, Orders: make(map[string] string)}}}
+
+	if (config.Acme.DirectoryCaFile != "") {
+
+		// trust the CA of a test server
+		ca_pem, err := os.ReadFile(config.Acme.DirectoryCaFile)
+		if (err != nil) {
+			fmt.Println("error reading acme directoryCaFile:", err)
+			os.Exit(1)
+		}
+
+		pool, pool_err := x509.SystemCertPool()
+		if (pool_err != nil) {
+			pool = x509.NewCertPool()
+		}
+		pool.AppendCertsFromPEM(ca_pem)
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+
+	}
+
+	var m = &autocert.Manager{
+		Prompt: autocert.AcceptTOS,
+		Cache: autocert.DirCache(cache_directory),
+		HostPolicy: autocert.HostWhitelist(names...),
+		Email: config.Acme.Email,
+		Client: client,
+	}
+
+	// HTTP-01 challenges are only used after the handler is created
+	acme_http_handler = m.HTTPHandler(nil)
+
+	return m
+
+}
+
+func acme_get_certificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	// return the ACME certificate of the server name, the first hostname of the default site is used when the client does not send SNI or sends another name
+
+	var name = normalize_host(hello.ServerName)
+
+	var names = acme_names()
+	for n := range names {
+		if (strings.TrimSuffix(strings.ToLower(names[n]), ".") == name) {
+			// a hostname, alias or name in acme.names
+			return acme_manager.GetCertificate(hello)
+		}
+	}
+
+	var s = site_for_host(name)
+	if (s == nil) {
+		return nil, errors.New("no site for server name " + hello.ServerName)
+	}
+
+	var h = *hello
+	h.ServerName = s.Hostnames[0]
+	return acme_manager.GetCertificate(&h)
+
+}
+
+func acme_obtain_certificates() {
+	// obtain the certificates when the server starts instead of in the first handshake, autocert renews them before they expire
+
+	var names = acme_names()
+
+	for n := range names {
+
+		cert, err := acme_manager.GetCertificate(&tls.ClientHelloInfo{ServerName: names[n]})
+		if (err != nil) {
+			fmt.Println("ACME certificate for", names[n], "was not obtained:", err)
+			continue
+		}
+
+		if (cert.Leaf == nil && len(cert.Certificate) > 0) {
+			cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+		}
+
+		log_certificate_expiry(cert)
+
+	}
+
+}
+
+func acme_http_challenge(conn net.Conn, buf []byte) {
+	// answer an HTTP-01 challenge request read on port 80 with the ACME client
+	// buf is the first read of the request, the rest of the request is read from the connection before the deadline
+
+	req, err := http.ReadRequest(bufio.NewReader(io.MultiReader(bytes.NewReader(buf), conn)))
+	if (err != nil) {
+		conn.Write([]byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+		return
+	}
+
+	// the host policy is checked without the port
+	host, _, host_err := net.SplitHostPort(req.Host)
+	if (host_err == nil) {
+		req.Host = host
+	}
+
+	var w = BufferResponseWriter{HeaderMap: make(http.Header), StatusCode: 200}
+	acme_http_handler.ServeHTTP(&w, req)
+
+	var response_headers = "HTTP/1.1 " + status_line(strconv.Itoa(w.StatusCode)) + "\r\n"
+	for k := range w.HeaderMap {
+		response_headers += k + ": " + w.HeaderMap.Get(k) + "\r\n"
+	}
+	response_headers += "Content-Length: " + strconv.Itoa(w.Body.Len()) + "\r\nConnection: close\r\n\r\n"
+
+	conn.Write(bytes.Join([][]byte{[]byte(response_headers), w.Body.Bytes()}, nil))
+
+}
+
+type AcmeOrderTransport struct {
+	Transport			http.RoundTripper
+	// finalize url to order url
+	Orders				map[string] string
+	Lock				sync.Mutex
+}
+
+func (t *AcmeOrderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// add the order url to finalize responses without a Location header
+	// a server that finalizes orders asynchronously (Pebble) may not send it and the ACME client polls the order with it
+
+	res, err := t.Transport.RoundTrip(req)
+	if (err != nil || strings.Index(res.Header.Get("Content-Type"), "json") == -1) {
+		return res, err
+	}
+
+	body, body_err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if (body_err != nil) {
+		return res, nil
+	}
+
+	var order struct {
+		Finalize			string	`json:"finalize"`
+	}
+	json.Unmarshal(body, &order)
+
+	if (order.Finalize == "") {
+		return res, nil
+	}
+
+	t.Lock.Lock()
+	if (res.Header.Get("Location") != "") {
+		// the response to a new order or the order
+		t.Orders[order.Finalize] = res.Header.Get("Location")
+	} else if (req.URL.String() == order.Finalize && t.Orders[order.Finalize] != "") {
+		// the response to finalize
+		res.Header.Set("Location", t.Orders[order.Finalize])
+	}
+	t.Lock.Unlock()
+
+	return res, nil
+
+}
+
+type BufferResponseWriter struct {
+	HeaderMap			http.Header
+	StatusCode			int
+	Body				bytes.Buffer
+}
+
+func (w *BufferResponseWriter) Header() (http.Header) {
+	return w.HeaderMap
+}
+
+func (w *BufferResponseWriter) Write(b []byte) (int, error) {
+	return w.Body.Write(b)
+}
+
+func (w *BufferResponseWriter) WriteHeader(status_code int) {
+	w.StatusCode = status_code
+}
+
+func log_certificate_expiry(cert *tls.Certificate) {
+	// log the expiry of the certificate and a warning when it expires within certExpiryWarningDays
+
+	if (cert.Leaf == nil) {
+		return
+	}
+
+	var warning_days = config.CertExpiryWarningDays
+	if (warning_days <= 0) {
+		warning_days = 14
+	}
+
+	var names = strings.Join(cert.Leaf.DNSNames, ", ")
+	if (names == "") {
+		names = cert.Leaf.Subject.CommonName
+	}
+
+	fmt.Println("TLS certificate for", names, "expires", cert.Leaf.NotAfter)
+
+	var remaining = time.Until(cert.Leaf.NotAfter)
+	if (remaining < time.Duration(warning_days) * 24 * time.Hour) {
+		fmt.Println("WARNING: the TLS certificate expires in", int64(remaining.Hours() / 24), "days on", cert.Leaf.NotAfter)
+	}
+
+}
+
+func certificate_files_fingerprint(s *Site) (string) {
+	// the size and modification time of each certificate file of the site, the files that symlinks point to are used
+
+	if (config.LoadCertificatesFromFiles == false) {
+		return ""
+	}
+
+	var fp = ""
+	var files = []string{s.SslCert, s.SslKey, s.SslCa, s.SslPassphraseFile}
+	for f := range files {
+
+		if (files[f] == "") {
+			continue
+		}
+
+		fi, err := os.Stat(files[f])
+		if (err == nil) {
+			fp += files[f] + " " + strconv.FormatInt(fi.Size(), 10) + " " + strconv.FormatInt(fi.ModTime().UnixNano(), 10) + "\n"
+		}
+
+	}
+
+	return fp
+
+}
+
+func certificate_loop() {
+	// load the certificate of a site again when the files change or on SIGHUP
+
+	var fp = make(map[*Site] string)
+	for i := range config.Sites {
+		fp[config.Sites[i]] = certificate_files_fingerprint(config.Sites[i])
+	}
+	var last_expiry_log = time.Now()
+
+	for {
+
+		var reload = false
+
+		select {
+		case <-certificate_reload:
+			reload = true
+		case <-time.After(30 * time.Second):
+		}
+
+		var log_expiry = time.Since(last_expiry_log) > 24 * time.Hour
+		if (log_expiry == true) {
+			last_expiry_log = time.Now()
+		}
+
+		for i := range config.Sites {
+
+			var s = config.Sites[i]
+			var new_fp = certificate_files_fingerprint(s)
+
+			if (reload == true || new_fp != fp[s]) {
+
+				cert, err := load_certificate(s)
+				if (err != nil) {
+					// the files may be partially written, the fingerprint is not updated so they are loaded again
+					fmt.Println("TLS certificate of", s.Hostnames[0], "was not reloaded, the previous certificate is used:", err)
+					continue
+				}
+
+				s.Certificate.Store(cert)
+				fp[s] = new_fp
+
+				fmt.Println("TLS certificate of", s.Hostnames[0], "reloaded")
+				log_certificate_expiry(cert)
+
+			} else if (log_expiry == true) {
+
+				// log the expiry each day
+				log_certificate_expiry(s.Certificate.Load())
+
+			}
+
+		}
+
+	}
+
+}
 func sig_h() {
 
 	sig := <-sigs
@@ -1376,6 +3857,16 @@ func sig_h() {
 
 	}
 
+	if (sig == syscall.SIGHUP) {
+
+		// load the TLS certificate again
+		select {
+		case certificate_reload <- true:
+		default:
+		}
+
+	}
+
 	if (sig == os.Interrupt || sig == os.Kill || sig == syscall.SIGTERM) {
 
 		// exit after printing log data
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func openssl(t *testing.T, dir string, args ...string) {
+	// run openssl in dir and fail the test when it fails
+
+	cmd := exec.Command("openssl", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if (err != nil) {
+		t.Fatalf("openssl %v: %s\n%s", args, err, out)
+	}
+
+}
+
+func TestCertFromPemBytesEncryptedKeys(t *testing.T) {
+	// each encrypted private key format is decrypted with the passphrase and rejected with a wrong or missing passphrase
+
+	_, err := exec.LookPath("openssl")
+	if (err != nil) {
+		t.Skip("openssl is not installed")
+	}
+
+	var dir = t.TempDir()
+	var passphrase = "correct horse"
+
+	openssl(t, dir, "genpkey", "-algorithm", "RSA", "-pkeyopt", "rsa_keygen_bits:2048", "-out", "plain.key")
+	openssl(t, dir, "req", "-new", "-x509", "-key", "plain.key", "-subj", "/CN=localhost", "-days", "1", "-out", "server.crt")
+
+	// PKCS#8 PBES2 with AES-256-CBC and HMAC-SHA256, openssl genpkey -aes256
+	openssl(t, dir, "pkcs8", "-topk8", "-in", "plain.key", "-v2", "aes256", "-passout", "pass:" + passphrase, "-out", "pkcs8_aes256.key")
+	// PKCS#8 PBES2 with DES-EDE3-CBC
+	openssl(t, dir, "pkcs8", "-topk8", "-in", "plain.key", "-v2", "des3", "-passout", "pass:" + passphrase, "-out", "pkcs8_des3.key")
+	// PKCS#8 PBES2 with AES-128-CBC and HMAC-SHA1
+	openssl(t, dir, "pkcs8", "-topk8", "-in", "plain.key", "-v2", "aes128", "-v2prf", "hmacWithSHA1", "-passout", "pass:" + passphrase, "-out", "pkcs8_aes128_sha1.key")
+	// legacy Proc-Type: 4,ENCRYPTED
+	openssl(t, dir, "rsa", "-in", "plain.key", "-traditional", "-aes256", "-passout", "pass:" + passphrase, "-out", "traditional_aes256.key")
+
+	// an EC key in PKCS#8 PBES2 with AES-256-CBC
+	openssl(t, dir, "genpkey", "-algorithm", "EC", "-pkeyopt", "ec_paramgen_curve:P-256", "-aes256", "-pass", "pass:" + passphrase, "-out", "ec_aes256.key")
+	openssl(t, dir, "req", "-new", "-x509", "-key", "ec_aes256.key", "-passin", "pass:" + passphrase, "-subj", "/CN=localhost", "-days", "1", "-out", "ec.crt")
+
+	var read = func(name string) ([]byte) {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if (err != nil) {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	var tests = []struct {
+		name		string
+		cert		string
+		key		string
+		password	string
+		valid		bool
+	}{
+		{"unencrypted", "server.crt", "plain.key", "", true},
+		{"unencrypted with passphrase", "server.crt", "plain.key", passphrase, true},
+		{"pkcs8 aes256", "server.crt", "pkcs8_aes256.key", passphrase, true},
+		{"pkcs8 aes256 wrong passphrase", "server.crt", "pkcs8_aes256.key", "wrong", false},
+		{"pkcs8 aes256 no passphrase", "server.crt", "pkcs8_aes256.key", "", false},
+		{"pkcs8 des3", "server.crt", "pkcs8_des3.key", passphrase, true},
+		{"pkcs8 des3 wrong passphrase", "server.crt", "pkcs8_des3.key", "wrong", false},
+		{"pkcs8 aes128 sha1", "server.crt", "pkcs8_aes128_sha1.key", passphrase, true},
+		{"pkcs8 aes128 sha1 wrong passphrase", "server.crt", "pkcs8_aes128_sha1.key", "wrong", false},
+		{"traditional aes256", "server.crt", "traditional_aes256.key", passphrase, true},
+		{"traditional aes256 wrong passphrase", "server.crt", "traditional_aes256.key", "wrong", false},
+		{"traditional aes256 no passphrase", "server.crt", "traditional_aes256.key", "", false},
+		{"ec pkcs8 aes256", "ec.crt", "ec_aes256.key", passphrase, true},
+		{"ec pkcs8 aes256 wrong passphrase", "ec.crt", "ec_aes256.key", "wrong", false},
+		{"key of another certificate", "ec.crt", "pkcs8_aes256.key", passphrase, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var pem_bytes = append(append(read(tt.cert), '\n'), read(tt.key)...)
+
+			cert, err := CertFromPemBytes(pem_bytes, tt.password)
+
+			if (tt.valid == true && err != nil) {
+				t.Fatalf("expected the key to load: %s", err)
+			}
+
+			if (tt.valid == false && err == nil) {
+				t.Fatal("expected an error")
+			}
+
+			if (tt.valid == true && cert.PrivateKey == nil) {
+				t.Fatal("no private key")
+			}
+
+		})
+	}
+
+}
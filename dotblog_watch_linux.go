@@ -0,0 +1,121 @@
+//go:build linux
+
+/*
+Copyright 2023 Andrew Hodel
+andrewhodel@gmail.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+func watch_content_files() {
+	// send to Site.ContentChanged when there are inotify events in the posts or template directory of the site
+	// content_loop polls at the configured interval if inotify is not available
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if (err != nil) {
+		fmt.Println("inotify is not available, polling posts/ and main/ for changes:", err)
+		return
+	}
+
+	var mask uint32 = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB | syscall.IN_DELETE_SELF
+
+	// the site of each watch descriptor, sites may share directories
+	var watch_sites = make(map[int32] []*Site)
+
+	// watch each directory in the posts and template directory of each site
+	var watch_dirs = func() {
+		for i := range config.Sites {
+
+			var s = config.Sites[i]
+
+			for _, root := range []string{s.PostsDirectory, s.TemplateDirectory} {
+				filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+
+					if (err == nil && info.IsDir() == true) {
+						wd, werr := syscall.InotifyAddWatch(fd, path, mask)
+						if (werr != nil) {
+							fmt.Println("inotify watch error:", path, werr)
+							return nil
+						}
+
+						var found = false
+						for w := range watch_sites[int32(wd)] {
+							if (watch_sites[int32(wd)][w] == s) {
+								found = true
+							}
+						}
+						if (found == false) {
+							watch_sites[int32(wd)] = append(watch_sites[int32(wd)], s)
+						}
+					}
+
+					return nil
+
+				})
+			}
+
+		}
+	}
+
+	watch_dirs()
+
+	var buf = make([]byte, syscall.SizeofInotifyEvent * 4096)
+
+	for {
+
+		n, rerr := syscall.Read(fd, buf)
+		if (rerr != nil) {
+			if (rerr == syscall.EINTR) {
+				continue
+			}
+			fmt.Println("inotify read error, polling posts/ and main/ for changes:", rerr)
+			syscall.Close(fd)
+			return
+		}
+
+		var changed_sites = make(map[*Site] bool)
+
+		var offset = 0
+		for (offset + syscall.SizeofInotifyEvent <= n) {
+
+			var event = (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+
+			for w := range watch_sites[event.Wd] {
+				changed_sites[watch_sites[event.Wd][w]] = true
+			}
+
+			if (event.Mask & syscall.IN_ISDIR != 0 && event.Mask & (syscall.IN_CREATE | syscall.IN_MOVED_TO) != 0) {
+				// a new directory, watch it and its subdirectories
+				// new watches on existing directories are ignored by inotify
+				watch_dirs()
+			}
+
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+		}
+
+		// notify content_loop of each site without blocking
+		for cs := range changed_sites {
+			select {
+			case cs.ContentChanged <- true:
+			default:
+			}
+		}
+
+	}
+
+}